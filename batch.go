@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Upper bound on URLs a single pattern may expand to, so a typo like
+// [1-99999999] doesn't lock up the UI.
+const maxPatternExpansion = 10000
+
+type batchItem struct {
+	URL      string
+	FileName string
+	Selected bool
+}
+
+// parseURLList splits text into URLs, one per line. Blank lines and lines
+// starting with # are skipped, and every line is pattern-expanded.
+func parseURLList(text string) ([]string, error) {
+	var urls []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		expanded, err := expandURLPattern(line)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, expanded...)
+		if len(urls) > maxPatternExpansion {
+			return nil, fmt.Errorf("too many URLs (limit is %d)", maxPatternExpansion)
+		}
+	}
+	return urls, nil
+}
+
+// expandURLPattern expands numeric ranges like [001-250], alphabetic
+// ranges like [a-z] and lists like {a,b,c}. Multiple patterns in the same
+// URL produce every combination.
+func expandURLPattern(pattern string) ([]string, error) {
+	start := strings.IndexAny(pattern, "[{")
+	if start == -1 {
+		return []string{pattern}, nil
+	}
+
+	closer := "]"
+	if pattern[start] == '{' {
+		closer = "}"
+	}
+	length := strings.Index(pattern[start:], closer)
+	if length == -1 {
+		// Not a pattern, e.g. an IPv6 host or a literal bracket
+		return []string{pattern}, nil
+	}
+	end := start + length
+
+	var values []string
+	var err error
+	if pattern[start] == '{' {
+		values = strings.Split(pattern[start+1:end], ",")
+	} else {
+		values, err = expandRange(pattern[start+1 : end])
+		if err != nil {
+			return nil, err
+		}
+		if values == nil {
+			// Bracket wasn't a range, keep it literally and continue after it
+			rest, err := expandURLPattern(pattern[end+1:])
+			if err != nil {
+				return nil, err
+			}
+			prefix := pattern[:end+1]
+			for i := range rest {
+				rest[i] = prefix + rest[i]
+			}
+			return rest, nil
+		}
+	}
+
+	rest, err := expandURLPattern(pattern[end+1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(values)*len(rest) > maxPatternExpansion {
+		return nil, fmt.Errorf("pattern expands to too many URLs (limit is %d)", maxPatternExpansion)
+	}
+
+	prefix := pattern[:start]
+	result := make([]string, 0, len(values)*len(rest))
+	for _, v := range values {
+		for _, r := range rest {
+			result = append(result, prefix+v+r)
+		}
+	}
+	return result, nil
+}
+
+// expandRange expands "001-250" or "a-z". It returns nil, nil when spec is
+// not a range so the caller can treat the brackets literally.
+func expandRange(spec string) ([]string, error) {
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok || from == "" || to == "" {
+		return nil, nil
+	}
+
+	if lo, err := strconv.Atoi(from); err == nil {
+		hi, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range [%s]", spec)
+		}
+		if hi < lo {
+			return nil, fmt.Errorf("invalid range [%s]: end is before start", spec)
+		}
+		if hi-lo+1 > maxPatternExpansion {
+			return nil, fmt.Errorf("range [%s] is too large", spec)
+		}
+
+		// Leading zeros on the start value set the width
+		width := 0
+		if len(from) > 1 && from[0] == '0' {
+			width = len(from)
+		}
+
+		values := make([]string, 0, hi-lo+1)
+		for i := lo; i <= hi; i++ {
+			values = append(values, fmt.Sprintf("%0*d", width, i))
+		}
+		return values, nil
+	}
+
+	if len(from) == 1 && len(to) == 1 && isAlpha(from[0]) && isAlpha(to[0]) {
+		if to[0] < from[0] {
+			return nil, fmt.Errorf("invalid range [%s]: end is before start", spec)
+		}
+		values := make([]string, 0, int(to[0]-from[0])+1)
+		for c := from[0]; c <= to[0]; c++ {
+			values = append(values, string(c))
+		}
+		return values, nil
+	}
+
+	return nil, nil
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// fileNameFromURL guesses the saved filename for a URL before the server
+// has been asked.
+func fileNameFromURL(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Path == "" {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
+
+func (d *Downloader) showBatchAdd() {
+	input := widget.NewMultiLineEntry()
+	input.SetPlaceHolder("One URL per line. Patterns: img[001-250].jpg, [a-z], {a,b,c}")
+	input.Wrapping = fyne.TextWrapOff
+	input.SetMinRowsVisible(6)
+
+	var items []batchItem
+
+	countLabel := widget.NewLabel("No URLs")
+	preview := widget.NewList(
+		func() int { return len(items) },
+		func() fyne.CanvasObject {
+			name := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+			urlLabel := widget.NewLabel("")
+			urlLabel.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil,
+				container.NewHBox(widget.NewCheck("", nil), name), nil, urlLabel)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			row := obj.(*fyne.Container)
+			urlLabel := row.Objects[0].(*widget.Label)
+			left := row.Objects[1].(*fyne.Container)
+			check := left.Objects[0].(*widget.Check)
+			name := left.Objects[1].(*widget.Label)
+
+			item := &items[id]
+			check.OnChanged = nil
+			check.SetChecked(item.Selected)
+			check.OnChanged = func(checked bool) {
+				item.Selected = checked
+			}
+			name.SetText(truncateString(item.FileName, 30))
+			urlLabel.SetText(item.URL)
+		},
+	)
+
+	// refresh rebuilds the preview from the text. URLs unticked in the
+	// previous preview stay unticked.
+	refresh := func() error {
+		unticked := map[string]bool{}
+		for _, item := range items {
+			if !item.Selected {
+				unticked[item.URL] = true
+			}
+		}
+
+		urls, err := parseURLList(input.Text)
+		if err != nil {
+			countLabel.SetText(err.Error())
+			items = nil
+			preview.Refresh()
+			return err
+		}
+
+		items = make([]batchItem, 0, len(urls))
+		for _, u := range urls {
+			name := fileNameFromURL(u)
+			if name == "" {
+				name = "(from server)"
+			}
+			items = append(items, batchItem{URL: u, FileName: name, Selected: !unticked[u]})
+		}
+		countLabel.SetText(fmt.Sprintf("%d URLs", len(items)))
+		preview.Refresh()
+		return nil
+	}
+
+	previewBtn := widget.NewButtonWithIcon("Preview", theme.ViewRefreshIcon(), func() { refresh() })
+
+	importBtn := widget.NewButtonWithIcon("Import .txt", theme.FileTextIcon(), func() {
+		fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("Failed to read list: %v", err), d.window)
+				return
+			}
+			text := strings.TrimRight(input.Text, "\n")
+			if text != "" {
+				text += "\n"
+			}
+			input.SetText(text + string(data))
+			refresh()
+		}, d.window)
+		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".txt"}))
+		fileDialog.Show()
+	})
+
+	mirrorsCheck := widget.NewCheck("Mirrors of one file", nil)
+
+	selectAll := widget.NewButton("All", func() {
+		for i := range items {
+			items[i].Selected = true
+		}
+		preview.Refresh()
+	})
+	selectNone := widget.NewButton("None", func() {
+		for i := range items {
+			items[i].Selected = false
+		}
+		preview.Refresh()
+	})
+
+	top := container.NewVBox(
+		input,
+		container.NewHBox(previewBtn, importBtn, widget.NewSeparator(), selectAll, selectNone, mirrorsCheck, countLabel),
+		widget.NewSeparator(),
+	)
+	content := container.NewBorder(top, nil, nil, nil, preview)
+
+	batchDialog := dialog.NewCustomConfirm("Batch Add", "Add Selected", "Cancel", content, func(add bool) {
+		if !add {
+			return
+		}
+		// Pick up edits made after the last preview
+		if err := refresh(); err != nil {
+			dialog.ShowError(err, d.window)
+			return
+		}
+
+		if mirrorsCheck.Checked {
+			d.queueMirrored(items)
+			return
+		}
+
+		var failed []string
+		for _, item := range items {
+			if !item.Selected {
+				continue
+			}
+			if err := d.queueDownload(item.URL); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", item.URL, err))
+			}
+		}
+		if len(failed) > 0 {
+			dialog.ShowError(fmt.Errorf("Some URLs could not be added:\n%s",
+				strings.Join(failed, "\n")), d.window)
+		}
+	}, d.window)
+
+	batchDialog.Resize(fyne.NewSize(800, 550))
+	batchDialog.Show()
+}
+
+// queueMirrored adds the selected URLs as one task whose chunks are spread
+// across all of them.
+func (d *Downloader) queueMirrored(items []batchItem) {
+	var mirrors []string
+	for _, item := range items {
+		if !item.Selected {
+			continue
+		}
+		if _, err := url.Parse(item.URL); err != nil {
+			dialog.ShowError(fmt.Errorf("Invalid URL: %v", err), d.window)
+			return
+		}
+		mirrors = append(mirrors, item.URL)
+	}
+	if len(mirrors) == 0 {
+		return
+	}
+
+	task := d.newUserTask(mirrors[0])
+	task.Mirrors = mirrors
+	d.addTask(task)
+}
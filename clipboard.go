@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// How often the clipboard is checked, and how many offered URLs we remember
+const (
+	clipboardInterval = time.Second
+	maxClipboardSeen  = 500
+)
+
+const defaultClipboardPatterns = `.iso
+.zip
+.tar.gz
+.7z
+.rar
+.dmg
+.exe
+.msi
+.deb
+.rpm
+.torrent`
+
+// clipboardSettings configures which copied links are offered for download.
+type clipboardSettings struct {
+	Enabled  bool
+	Prompt   bool   // Ask in a banner instead of filling the URL field
+	Patterns string // One per line: an extension like .iso, or a regular expression
+}
+
+// Links worth looking at inside copied text
+var clipboardURLPattern = regexp.MustCompile(`(?:https?|ftps?|sftp)://[^\s"'<>]+|magnet:\?[^\s"'<>]+`)
+
+type clipboardMatcher struct {
+	exts []string
+	res  []*regexp.Regexp
+}
+
+func parseClipboardPatterns(text string) (*clipboardMatcher, error) {
+	m := &clipboardMatcher{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, ".") && !strings.ContainsAny(line, `\*+?()[]{}|^$`):
+			m.exts = append(m.exts, strings.ToLower(line))
+		default:
+			re, err := regexp.Compile(line)
+			if err != nil {
+				return nil, fmt.Errorf("pattern %q: %v", line, err)
+			}
+			m.res = append(m.res, re)
+		}
+	}
+	return m, nil
+}
+
+func (m *clipboardMatcher) match(urlStr string) bool {
+	for _, re := range m.res {
+		if re.MatchString(urlStr) {
+			return true
+		}
+	}
+	if strings.HasPrefix(urlStr, "magnet:") {
+		return false
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	p := strings.ToLower(u.Path)
+	for _, ext := range m.exts {
+		if strings.HasSuffix(p, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// clipboardWatcher remembers what it has already offered so a URL comes up
+// only once, however often it is copied.
+type clipboardWatcher struct {
+	mu      sync.Mutex
+	matcher *clipboardMatcher
+	last    string // Clipboard text at the previous check
+	primed  bool   // Whatever was copied before watching started is ignored
+	seen    map[string]bool
+	order   []string
+	pending []string // URLs waiting in the banner
+}
+
+func newClipboardWatcher() *clipboardWatcher {
+	m, _ := parseClipboardPatterns(defaultClipboardPatterns)
+	return &clipboardWatcher{matcher: m, seen: map[string]bool{}}
+}
+
+func (w *clipboardWatcher) setPatterns(m *clipboardMatcher) {
+	w.mu.Lock()
+	w.matcher = m
+	w.mu.Unlock()
+}
+
+// offer returns the matching URLs in text that have not been offered yet.
+// They count as offered once passed to markSeen.
+func (w *clipboardWatcher) offer(text string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if text == w.last {
+		return nil
+	}
+	w.last = text
+	if !w.primed {
+		w.primed = true
+		return nil
+	}
+
+	var found []string
+	for _, u := range clipboardURLPattern.FindAllString(text, -1) {
+		u = strings.TrimRight(u, ".,;:)]}")
+		if w.seen[u] || !w.matcher.match(u) || slices.Contains(found, u) {
+			continue
+		}
+		found = append(found, u)
+	}
+	return found
+}
+
+// markSeen keeps urls from being offered again.
+func (w *clipboardWatcher) markSeen(urls ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, u := range urls {
+		if w.seen[u] {
+			continue
+		}
+		w.seen[u] = true
+		w.order = append(w.order, u)
+		if len(w.order) > maxClipboardSeen {
+			delete(w.seen, w.order[0])
+			w.order = w.order[1:]
+		}
+	}
+}
+
+// recheck makes the next check scan the clipboard again even if it has not
+// changed, for links that could not be offered yet.
+func (w *clipboardWatcher) recheck() {
+	w.mu.Lock()
+	w.last = ""
+	w.mu.Unlock()
+}
+
+func (d *Downloader) runClipboardWatch() {
+	ticker := time.NewTicker(clipboardInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cfg := d.config().Clipboard
+		if !cfg.Enabled {
+			d.clipboard.mu.Lock()
+			d.clipboard.primed = false
+			d.clipboard.mu.Unlock()
+			continue
+		}
+
+		var text string
+		fyne.DoAndWait(func() {
+			text = d.app.Clipboard().Content()
+		})
+		urls := d.clipboard.offer(text)
+		if len(urls) == 0 {
+			continue
+		}
+
+		// Skip anything already in the list
+		d.mu.Lock()
+		fresh := urls[:0]
+		for _, u := range urls {
+			known := false
+			for _, task := range d.tasks {
+				if task.URL == u {
+					known = true
+					break
+				}
+			}
+			if known {
+				d.clipboard.markSeen(u)
+			} else {
+				fresh = append(fresh, u)
+			}
+		}
+		d.mu.Unlock()
+
+		fyne.Do(func() {
+			d.offerClipboardURLs(fresh, cfg.Prompt)
+		})
+	}
+}
+
+// offerClipboardURLs queues the links in the banner, or fills the URL field
+// with one when it is free and leaves the rest for later checks. Runs on
+// the UI thread.
+func (d *Downloader) offerClipboardURLs(urls []string, prompt bool) {
+	if len(urls) == 0 {
+		return
+	}
+	if !prompt {
+		if d.urlEntry.Text == "" {
+			d.urlEntry.SetText(urls[0])
+			d.clipboard.markSeen(urls[0])
+			urls = urls[1:]
+		}
+		if len(urls) > 0 {
+			d.clipboard.recheck()
+		}
+		return
+	}
+
+	d.clipboard.markSeen(urls...)
+	d.clipboard.mu.Lock()
+	d.clipboard.pending = append(d.clipboard.pending, urls...)
+	d.clipboard.mu.Unlock()
+	d.showClipboardBanner()
+}
+
+// createClipboardBanner builds the "Download this?" bar shown above the
+// task list.
+func (d *Downloader) createClipboardBanner() fyne.CanvasObject {
+	d.clipboardLabel = widget.NewLabel("")
+	d.clipboardLabel.Truncation = fyne.TextTruncateEllipsis
+
+	next := func(download bool) {
+		d.clipboard.mu.Lock()
+		var u string
+		if len(d.clipboard.pending) > 0 {
+			u = d.clipboard.pending[0]
+			d.clipboard.pending = d.clipboard.pending[1:]
+		}
+		d.clipboard.mu.Unlock()
+
+		if download && u != "" {
+			if err := d.queueDownload(u); err != nil {
+				dialog.ShowError(err, d.window)
+			}
+		}
+		d.showClipboardBanner()
+	}
+
+	downloadBtn := widget.NewButtonWithIcon("Download", theme.DownloadIcon(), func() { next(true) })
+	downloadBtn.Importance = widget.HighImportance
+	dismissBtn := widget.NewButtonWithIcon("", theme.CancelIcon(), func() { next(false) })
+	dismissBtn.Importance = widget.LowImportance
+
+	d.clipboardBar = container.NewBorder(nil, nil,
+		widget.NewIcon(theme.ContentPasteIcon()),
+		container.NewHBox(downloadBtn, dismissBtn),
+		d.clipboardLabel,
+	)
+	d.clipboardBar.Hide()
+	return d.clipboardBar
+}
+
+func (d *Downloader) showClipboardBanner() {
+	d.clipboard.mu.Lock()
+	pending := append([]string(nil), d.clipboard.pending...)
+	d.clipboard.mu.Unlock()
+
+	if len(pending) == 0 {
+		d.clipboardBar.Hide()
+		return
+	}
+	text := "Download this? " + pending[0]
+	if len(pending) > 1 {
+		text = fmt.Sprintf("Download this? (%d more) %s", len(pending)-1, pending[0])
+	}
+	d.clipboardLabel.SetText(text)
+	d.clipboardBar.Show()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// The URL inside a macOS .webloc file
+var weblocURLPattern = regexp.MustCompile(`<string>([^<]+)</string>`)
+
+// A link inside a dropped "file" path. The driver has made it absolute and
+// collapsed its double slash, e.g. /home/me/https:/host/file.iso.
+var droppedLinkPattern = regexp.MustCompile(`(?i)(?:^|[/\\])((?:https?|ftps?|sftp|s3|davs?|webdavs?):)[/\\]+(.*)$|(magnet:\?.*)$`)
+
+// handleDrop queues whatever was dropped on the window: links dragged
+// from a browser, URL list files, torrents, metalinks and link shortcuts.
+func (d *Downloader) handleDrop(_ fyne.Position, items []fyne.URI) {
+	go func() {
+		var problems []string
+		for _, item := range items {
+			urls, err := droppedURLs(item)
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			for _, u := range urls {
+				var qerr error
+				fyne.DoAndWait(func() {
+					qerr = d.queueDownload(u)
+				})
+				if qerr != nil {
+					problems = append(problems, fmt.Sprintf("%s: %v", u, qerr))
+				}
+			}
+		}
+
+		if len(problems) > 0 {
+			fyne.Do(func() {
+				dialog.ShowError(fmt.Errorf("Some dropped items were not added:\n%s",
+					strings.Join(problems, "\n")), d.window)
+			})
+		}
+	}()
+}
+
+// droppedURLs turns one dropped item into the URLs to queue. Desktop
+// drivers report every drop as a file, so links from a browser arrive as a
+// file URI whose path ends with the link.
+func droppedURLs(item fyne.URI) ([]string, error) {
+	if item.Scheme() != "file" {
+		return []string{item.String()}, nil
+	}
+	p := item.Path()
+	info, err := os.Stat(p)
+	if err != nil {
+		if m := droppedLinkPattern.FindStringSubmatch(p); m != nil {
+			if m[3] != "" {
+				return []string{m[3]}, nil
+			}
+			return []string{m[1] + "//" + filepath.ToSlash(m[2])}, nil
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s: folders cannot be dropped", filepath.Base(p))
+	}
+
+	name := strings.ToLower(p)
+	switch {
+	case isTorrentURL(name), isMetalinkURL(name):
+		return []string{fileURL(p)}, nil
+
+	case strings.HasSuffix(name, ".txt"), strings.HasSuffix(name, ".lst"):
+		data, err := readListFile(p)
+		if err != nil {
+			return nil, err
+		}
+		urls, err := parseURLList(string(data))
+		if err == nil && len(urls) == 0 {
+			err = fmt.Errorf("%s: no URLs found", filepath.Base(p))
+		}
+		return urls, err
+
+	case strings.HasSuffix(name, ".url"):
+		// Windows Internet Shortcut: an INI file with URL=
+		file, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if u, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "URL="); ok {
+				return []string{u}, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: no URL in shortcut", filepath.Base(p))
+
+	case strings.HasSuffix(name, ".webloc"):
+		data, err := readListFile(p)
+		if err != nil {
+			return nil, err
+		}
+		if m := weblocURLPattern.FindSubmatch(data); m != nil {
+			return []string{strings.TrimSpace(string(m[1]))}, nil
+		}
+		return nil, fmt.Errorf("%s: no URL in shortcut", filepath.Base(p))
+	}
+	return nil, fmt.Errorf("%s: not a URL list, torrent or metalink", filepath.Base(p))
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	sources["ftp"] = ftpSource{}
+	sources["ftps"] = ftpSource{}
+}
+
+// ftpSource downloads over FTP and FTPS. Every range gets its own control
+// connection since FTP allows one transfer per session; REST sets the
+// starting offset. ftps:// on port 990 uses implicit TLS, any other port
+// upgrades with AUTH TLS.
+type ftpSource struct{}
+
+func (ftpSource) stat(u *url.URL) (int64, string, error) {
+	c, err := dialFTP(u)
+	if err != nil {
+		return 0, "", err
+	}
+	defer c.quit()
+
+	code, msg, err := c.cmd(2, "SIZE %s", ftpPath(u))
+	if err != nil || code != 213 {
+		// Not every server implements SIZE; chunking needs it, the
+		// single-stream fallback doesn't
+		return 0, "", nil
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("unexpected SIZE reply: %s", msg)
+	}
+	return size, "", nil
+}
+
+func (ftpSource) openRange(u *url.URL, start, end int64) (io.ReadCloser, error) {
+	c, err := dialFTP(u)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.passive()
+	if err != nil {
+		c.quit()
+		return nil, err
+	}
+
+	if start > 0 {
+		if _, _, err := c.cmd(3, "REST %d", start); err != nil {
+			data.Close()
+			c.quit()
+			return nil, fmt.Errorf("server does not support resume: %v", err)
+		}
+	}
+	if _, _, err := c.cmd(1, "RETR %s", ftpPath(u)); err != nil {
+		data.Close()
+		c.quit()
+		return nil, err
+	}
+
+	return newRangeReader(data, start, end, func() error {
+		data.Close()
+		// The transfer-complete reply is skipped when we stop mid-file
+		c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+		c.text.ReadResponse(2)
+		c.quit()
+		return nil
+	}), nil
+}
+
+type ftpConn struct {
+	conn      net.Conn
+	text      *textproto.Conn
+	tlsConfig *tls.Config // nil for plain FTP
+}
+
+func dialFTP(u *url.URL) (*ftpConn, error) {
+	secure := strings.EqualFold(u.Scheme, "ftps")
+	port := u.Port()
+	if port == "" {
+		port = "21"
+		if secure {
+			port = "990"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	c := &ftpConn{conn: conn}
+	if secure {
+		c.tlsConfig = &tls.Config{
+			ServerName: u.Hostname(),
+			// Servers commonly require the data channel to resume the
+			// control channel's session
+			ClientSessionCache: tls.NewLRUClientSessionCache(4),
+		}
+	}
+
+	implicit := secure && port == "990"
+	if implicit {
+		c.conn = tls.Client(conn, c.tlsConfig)
+	}
+	c.text = textproto.NewConn(c.conn)
+
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+
+	if secure && !implicit {
+		if _, _, err := c.cmd(2, "AUTH TLS"); err != nil {
+			c.conn.Close()
+			return nil, err
+		}
+		c.conn = tls.Client(conn, c.tlsConfig)
+		c.text = textproto.NewConn(c.conn)
+	}
+
+	if err := c.login(u); err != nil {
+		c.quit()
+		return nil, err
+	}
+
+	if secure {
+		if _, _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			c.quit()
+			return nil, err
+		}
+		if _, _, err := c.cmd(2, "PROT P"); err != nil {
+			c.quit()
+			return nil, err
+		}
+	}
+
+	if _, _, err := c.cmd(2, "TYPE I"); err != nil {
+		c.quit()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (c *ftpConn) login(u *url.URL) error {
+	user, pass := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			pass = p
+		}
+	}
+
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case 230:
+		return nil
+	case 331:
+		if _, _, err := c.cmd(2, "PASS %s", pass); err != nil {
+			return fmt.Errorf("FTP login failed: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("FTP login failed: unexpected reply %d", code)
+}
+
+// cmd sends a command and reads its reply. expect is the leading digit of
+// acceptable reply codes, or 0 to accept anything.
+func (c *ftpConn) cmd(expect int, format string, args ...any) (int, string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+
+	code, msg, err := c.text.ReadResponse(expect)
+	if expect == 0 {
+		if _, ok := err.(*textproto.Error); ok {
+			err = nil
+		}
+	}
+	return code, msg, err
+}
+
+// passive opens a data connection, preferring EPSV and falling back to
+// PASV. The address in a PASV reply is ignored in favour of the control
+// connection's host so servers behind NAT still work.
+func (c *ftpConn) passive() (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+
+	var port int
+	if code, msg, err := c.cmd(2, "EPSV"); err == nil && code == 229 {
+		// 229 Entering Extended Passive Mode (|||6446|)
+		if open := strings.Index(msg, "("); open != -1 {
+			fields := strings.Split(strings.Trim(msg[open+1:], ")"), "|")
+			if len(fields) >= 4 {
+				port, _ = strconv.Atoi(fields[3])
+			}
+		}
+	}
+	if port == 0 {
+		_, msg, err := c.cmd(2, "PASV")
+		if err != nil {
+			return nil, err
+		}
+		// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+		open, end := strings.Index(msg, "("), strings.Index(msg, ")")
+		if open == -1 || end < open {
+			return nil, fmt.Errorf("unexpected PASV reply: %s", msg)
+		}
+		parts := strings.Split(msg[open+1:end], ",")
+		if len(parts) != 6 {
+			return nil, fmt.Errorf("unexpected PASV reply: %s", msg)
+		}
+		hi, _ := strconv.Atoi(parts[4])
+		lo, _ := strconv.Atoi(parts[5])
+		port = hi<<8 | lo
+	}
+
+	data, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if c.tlsConfig != nil {
+		return tls.Client(data, c.tlsConfig), nil
+	}
+	return data, nil
+}
+
+func (c *ftpConn) quit() {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c.cmd(2, "QUIT")
+	c.conn.Close()
+}
+
+// ftpPath turns the URL path into a path relative to the login directory,
+// as RFC 1738 specifies. %2F at the start gives an absolute path.
+func ftpPath(u *url.URL) string {
+	return strings.TrimPrefix(u.Path, "/")
+}
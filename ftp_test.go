@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testFTPServer serves one file to a logged-in user over passive data
+// connections, and records the commands it receives.
+type testFTPServer struct {
+	ln       net.Listener
+	path     string
+	data     []byte
+	noEPSV   bool // Reply 502 to EPSV so clients fall back to PASV
+	noREST   bool // Reply 502 to REST
+	mu       sync.Mutex
+	commands []string
+}
+
+// startFTPServer serves s.data as pub/file.bin.
+func startFTPServer(t *testing.T, s *testFTPServer) *testFTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ln, s.path = ln, "pub/file.bin"
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testFTPServer) url(path string) *url.URL {
+	u, _ := url.Parse("ftp://user:secret@" + s.ln.Addr().String() + "/" + path)
+	return u
+}
+
+func (s *testFTPServer) sent(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []string
+	for _, c := range s.commands {
+		if strings.HasPrefix(c, prefix) {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+func (s *testFTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...any) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	reply("220 test server ready")
+	var data net.Listener
+	var offset int64
+	loggedIn := false
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "USER":
+			reply("331 password please")
+		case "PASS":
+			if arg != "secret" {
+				reply("530 login incorrect")
+				continue
+			}
+			loggedIn = true
+			reply("230 logged in")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			if !loggedIn {
+				reply("530 not logged in")
+				continue
+			}
+			switch strings.ToUpper(verb) {
+			case "TYPE":
+				reply("200 type set")
+			case "SIZE":
+				if arg != s.path {
+					reply("550 no such file")
+					continue
+				}
+				reply("213 %d", len(s.data))
+			case "EPSV", "PASV":
+				if verb == "EPSV" && s.noEPSV {
+					reply("502 not implemented")
+					continue
+				}
+				if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+					reply("425 no data connection")
+					continue
+				}
+				port := data.Addr().(*net.TCPAddr).Port
+				if verb == "EPSV" {
+					reply("229 Entering Extended Passive Mode (|||%d|)", port)
+				} else {
+					// An address the client cannot reach, as from behind NAT
+					reply("227 Entering Passive Mode (10,255,255,1,%d,%d)", port>>8, port&0xff)
+				}
+			case "REST":
+				if s.noREST {
+					reply("502 not implemented")
+					continue
+				}
+				offset, _ = strconv.ParseInt(arg, 10, 64)
+				reply("350 restarting at %d", offset)
+			case "RETR":
+				if data == nil || arg != s.path || offset > int64(len(s.data)) {
+					reply("550 cannot send")
+					continue
+				}
+				reply("150 opening data connection")
+				dc, err := data.Accept()
+				data.Close()
+				data = nil
+				if err != nil {
+					reply("425 no data connection")
+					continue
+				}
+				_, err = dc.Write(s.data[offset:])
+				dc.Close()
+				offset = 0
+				if err != nil {
+					reply("426 transfer aborted")
+					continue
+				}
+				reply("226 transfer complete")
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}
+}
+
+func ftpTestData(t *testing.T) []byte {
+	data := make([]byte, 64*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFTPStat(t *testing.T) {
+	data := ftpTestData(t)
+	s := startFTPServer(t, &testFTPServer{data: data})
+
+	size, _, err := ftpSource{}.stat(s.url("pub/file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("size %d, want %d", size, len(data))
+	}
+
+	// A server that cannot tell the size still allows a single stream
+	size, _, err = ftpSource{}.stat(s.url("pub/missing.bin"))
+	if err != nil || size != 0 {
+		t.Errorf("missing SIZE: got %d, %v; want 0, nil", size, err)
+	}
+}
+
+func TestFTPOpenRange(t *testing.T) {
+	data := ftpTestData(t)
+
+	tests := []struct {
+		name       string
+		noEPSV     bool
+		start, end int64
+	}{
+		{"EPSV whole file", false, 0, -1},
+		{"EPSV resume to EOF", false, 1000, -1},
+		{"EPSV middle chunk", false, 4096, 8191},
+		{"PASV whole file", true, 0, -1},
+		{"PASV middle chunk", true, 4096, 8191},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := startFTPServer(t, &testFTPServer{data: data, noEPSV: tt.noEPSV})
+
+			body, err := ftpSource{}.openRange(s.url("pub/file.bin"), tt.start, tt.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(body)
+			body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := data[tt.start:]
+			if tt.end >= 0 {
+				want = data[tt.start : tt.end+1]
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("read %d bytes that differ from the %d expected", len(got), len(want))
+			}
+
+			if pasv := s.sent("PASV"); tt.noEPSV != (len(pasv) == 1) {
+				t.Errorf("PASV sent %d times with EPSV disabled=%v", len(pasv), tt.noEPSV)
+			}
+			rest := s.sent("REST")
+			switch {
+			case tt.start == 0 && len(rest) != 0:
+				t.Errorf("sent %q for a read from the start", rest)
+			case tt.start > 0 && !slices.Equal(rest, []string{"REST " + strconv.FormatInt(tt.start, 10)}):
+				t.Errorf("sent %q, want REST %d", rest, tt.start)
+			}
+		})
+	}
+}
+
+func TestFTPOpenRangeWithoutREST(t *testing.T) {
+	s := startFTPServer(t, &testFTPServer{data: ftpTestData(t), noREST: true})
+
+	_, err := ftpSource{}.openRange(s.url("pub/file.bin"), 1000, -1)
+	if err == nil || !strings.Contains(err.Error(), "does not support resume") {
+		t.Fatalf("got %v, want a resume error", err)
+	}
+}
+
+func TestFTPLoginFailure(t *testing.T) {
+	s := startFTPServer(t, &testFTPServer{data: ftpTestData(t)})
+	u := s.url("pub/file.bin")
+	u.User = url.UserPassword("user", "wrong")
+
+	_, err := ftpSource{}.openRange(u, 0, -1)
+	if err == nil || !strings.Contains(err.Error(), "login failed") {
+		t.Fatalf("got %v, want a login error", err)
+	}
+}
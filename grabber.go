@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"golang.org/x/net/html"
+)
+
+// Pages larger than this are cut off before parsing.
+const maxPageSize = 8 * 1024 * 1024
+
+// Parallel HEAD requests when checking sizes.
+const sizeProbeWorkers = 4
+
+// Sizes as printed in autoindex listings: 1234, 1.2K, 3M, 4.5G.
+var autoindexSize = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)([KMGT]?)B?$`)
+
+type grabbedLink struct {
+	URL      string
+	FileName string
+	Size     int64 // -1 until known
+	Selected bool
+}
+
+// tags whose src attribute points at something downloadable
+var srcTags = map[string]bool{
+	"img": true, "script": true, "source": true, "video": true, "audio": true,
+	"iframe": true, "embed": true, "track": true, "input": true,
+}
+
+// fetchPage downloads an HTML page and returns it with its final URL after
+// redirects, which relative links resolve against.
+func fetchPage(pageURL string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, resp.Request.URL, nil
+}
+
+// linkAllowed keeps web and magnet links. Other schemes are refused so a
+// remote page cannot queue local copies or reach into SFTP, S3 and other
+// accounts configured here.
+func linkAllowed(u *url.URL) bool {
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "magnet":
+		return true
+	}
+	return false
+}
+
+// extractLinks collects anchors and src attributes from a page. Apache and
+// nginx autoindex listings also yield sizes, and their sort and parent
+// directory links are dropped.
+func extractLinks(base *url.URL, r io.Reader) []*grabbedLink {
+	var links []*grabbedLink
+	var trailing []string // text after each link, where autoindex puts sizes
+	index := map[string]int{}
+
+	title := ""
+	inTitle := false
+	last := -1
+
+	add := func(ref string) int {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "#") {
+			return -1
+		}
+		parsed, err := url.Parse(ref)
+		if err != nil {
+			return -1
+		}
+		abs := base.ResolveReference(parsed)
+		abs.Fragment = ""
+		if !linkAllowed(abs) {
+			return -1
+		}
+
+		key := abs.String()
+		if i, ok := index[key]; ok {
+			return i
+		}
+		name := fileNameFromURL(key)
+		if strings.HasSuffix(abs.Path, "/") && name != "" {
+			name += "/"
+		}
+		if name == "" {
+			name = abs.Host
+		}
+		if name == "" {
+			name = key
+		}
+		index[key] = len(links)
+		links = append(links, &grabbedLink{URL: key, FileName: name, Size: -1})
+		trailing = append(trailing, "")
+		return len(links) - 1
+	}
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			attr := func(name string) (string, bool) {
+				for _, a := range tok.Attr {
+					if a.Key == name {
+						return a.Val, true
+					}
+				}
+				return "", false
+			}
+
+			switch {
+			case tok.Data == "base":
+				if href, ok := attr("href"); ok {
+					if u, err := url.Parse(strings.TrimSpace(href)); err == nil {
+						base = base.ResolveReference(u)
+					}
+				}
+			case tok.Data == "title":
+				inTitle = true
+			case tok.Data == "a" || tok.Data == "area":
+				if href, ok := attr("href"); ok {
+					last = add(href)
+				}
+			case srcTags[tok.Data]:
+				if src, ok := attr("src"); ok {
+					add(src)
+				}
+			}
+
+		case html.EndTagToken:
+			switch z.Token().Data {
+			case "title":
+				inTitle = false
+			case "tr":
+				last = -1
+			}
+
+		case html.TextToken:
+			text := string(z.Text())
+			if inTitle {
+				title += text
+			} else if last >= 0 {
+				trailing[last] += " " + text
+			}
+		}
+	}
+
+	if !strings.HasPrefix(strings.TrimSpace(title), "Index of") {
+		return links
+	}
+
+	// Autoindex: drop sort links (?C=N;O=D) and anything above this folder
+	dir := base.Path
+	if !strings.HasSuffix(dir, "/") {
+		dir = dir[:strings.LastIndex(dir, "/")+1]
+	}
+	var listed []*grabbedLink
+	for i, link := range links {
+		u, _ := url.Parse(link.URL)
+		if u.Host == base.Host {
+			if u.RawQuery != "" && u.Path == base.Path {
+				continue
+			}
+			if u.Path == dir || !strings.HasPrefix(u.Path, dir) {
+				continue
+			}
+		}
+		fields := strings.Fields(trailing[i])
+		if len(fields) > 0 {
+			link.Size = parseListingSize(fields[len(fields)-1])
+		}
+		listed = append(listed, link)
+	}
+	return listed
+}
+
+// parseListingSize reads a size column from an autoindex listing; -1 when
+// it is missing or a directory's "-".
+func parseListingSize(s string) int64 {
+	m := autoindexSize.FindStringSubmatch(s)
+	if m == nil {
+		return -1
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return -1
+	}
+	switch strings.ToUpper(m[2]) {
+	case "K":
+		value *= 1024
+	case "M":
+		value *= 1024 * 1024
+	case "G":
+		value *= 1024 * 1024 * 1024
+	case "T":
+		value *= 1024 * 1024 * 1024 * 1024
+	}
+	return int64(value)
+}
+
+// probeSize asks for a link's size without downloading it. Returns -1 if
+// the server does not say.
+func probeSize(urlStr string) int64 {
+	if src := sourceFor(urlStr); src != nil {
+		u, err := url.Parse(urlStr)
+		if err != nil {
+			return -1
+		}
+		size, _, err := src.stat(u)
+		if err != nil || size <= 0 {
+			return -1
+		}
+		return size
+	}
+
+	req, err := http.NewRequest("HEAD", urlStr, nil)
+	if err != nil {
+		return -1
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return -1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < 0 {
+		return -1
+	}
+	return resp.ContentLength
+}
+
+func formatLinkSize(size int64) string {
+	if size < 0 {
+		return "?"
+	}
+	if size < 1024*1024 {
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+}
+
+func (d *Downloader) showGrabLinks() {
+	pageEntry := widget.NewEntry()
+	pageEntry.SetPlaceHolder("Page or directory listing URL")
+	if strings.HasPrefix(d.urlEntry.Text, "http") {
+		pageEntry.SetText(strings.TrimSpace(d.urlEntry.Text))
+	}
+
+	extEntry := widget.NewEntry()
+	extEntry.SetPlaceHolder("zip, iso, tar.gz")
+	regexEntry := widget.NewEntry()
+	regexEntry.SetPlaceHolder("Regular expression on URL")
+	minEntry := widget.NewEntry()
+	minEntry.SetPlaceHolder("Min MB")
+	maxEntry := widget.NewEntry()
+	maxEntry.SetPlaceHolder("Max MB")
+
+	var all, visible []*grabbedLink
+	statusLabel := widget.NewLabel("")
+
+	list := widget.NewList(
+		func() int { return len(visible) },
+		func() fyne.CanvasObject {
+			name := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+			size := widget.NewLabel("")
+			urlLabel := widget.NewLabel("")
+			urlLabel.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil,
+				container.NewHBox(widget.NewCheck("", nil), name, size), nil, urlLabel)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			row := obj.(*fyne.Container)
+			urlLabel := row.Objects[0].(*widget.Label)
+			left := row.Objects[1].(*fyne.Container)
+			check := left.Objects[0].(*widget.Check)
+			name := left.Objects[1].(*widget.Label)
+			size := left.Objects[2].(*widget.Label)
+
+			link := visible[id]
+			check.OnChanged = nil
+			check.SetChecked(link.Selected)
+			check.OnChanged = func(checked bool) {
+				link.Selected = checked
+			}
+			name.SetText(truncateString(link.FileName, 30))
+			size.SetText(formatLinkSize(link.Size))
+			urlLabel.SetText(link.URL)
+		},
+	)
+
+	// applyFilter rebuilds the visible list. Links of unknown size are
+	// hidden once a size bound is set.
+	applyFilter := func() {
+		var exts []string
+		for _, e := range strings.Split(extEntry.Text, ",") {
+			if e = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(e), ".")); e != "" {
+				exts = append(exts, "."+e)
+			}
+		}
+
+		var pattern *regexp.Regexp
+		if expr := strings.TrimSpace(regexEntry.Text); expr != "" {
+			var err error
+			if pattern, err = regexp.Compile(expr); err != nil {
+				statusLabel.SetText("Invalid regex")
+				return
+			}
+		}
+
+		minSize, minErr := strconv.ParseFloat(strings.TrimSpace(minEntry.Text), 64)
+		maxSize, maxErr := strconv.ParseFloat(strings.TrimSpace(maxEntry.Text), 64)
+
+		visible = visible[:0]
+		for _, link := range all {
+			if len(exts) > 0 {
+				u, _ := url.Parse(link.URL)
+				lower := strings.ToLower(u.Path)
+				matched := false
+				for _, ext := range exts {
+					if strings.HasSuffix(lower, ext) {
+						matched = true
+						break
+					}
+				}
+				if !matched {
+					continue
+				}
+			}
+			if pattern != nil && !pattern.MatchString(link.URL) {
+				continue
+			}
+			if minErr == nil && (link.Size < 0 || float64(link.Size) < minSize*1024*1024) {
+				continue
+			}
+			if maxErr == nil && (link.Size < 0 || float64(link.Size) > maxSize*1024*1024) {
+				continue
+			}
+			visible = append(visible, link)
+		}
+		statusLabel.SetText(fmt.Sprintf("%d of %d links", len(visible), len(all)))
+		list.Refresh()
+	}
+
+	extEntry.OnChanged = func(string) { applyFilter() }
+	regexEntry.OnChanged = func(string) { applyFilter() }
+	minEntry.OnChanged = func(string) { applyFilter() }
+	maxEntry.OnChanged = func(string) { applyFilter() }
+
+	fetchBtn := widget.NewButtonWithIcon("Fetch", theme.SearchIcon(), nil)
+	fetchBtn.OnTapped = func() {
+		pageURL := strings.TrimSpace(pageEntry.Text)
+		if pageURL == "" {
+			return
+		}
+		fetchBtn.Disable()
+		statusLabel.SetText("Fetching page...")
+
+		go func() {
+			data, final, err := fetchPage(pageURL)
+			var links []*grabbedLink
+			if err == nil {
+				links = extractLinks(final, bytes.NewReader(data))
+			}
+
+			fyne.Do(func() {
+				fetchBtn.Enable()
+				if err != nil {
+					statusLabel.SetText("")
+					dialog.ShowError(fmt.Errorf("Failed to fetch %s: %v", pageURL, err), d.window)
+					return
+				}
+				all = links
+				applyFilter()
+			})
+		}()
+	}
+
+	sizesBtn := widget.NewButtonWithIcon("Check Sizes", theme.InfoIcon(), nil)
+	sizesBtn.OnTapped = func() {
+		var pending []*grabbedLink
+		for _, link := range visible {
+			if link.Size < 0 && !strings.HasSuffix(link.FileName, "/") {
+				pending = append(pending, link)
+			}
+		}
+		if len(pending) == 0 {
+			return
+		}
+		sizesBtn.Disable()
+		statusLabel.SetText(fmt.Sprintf("Checking %d sizes...", len(pending)))
+
+		go func() {
+			sizes := make([]int64, len(pending))
+			jobs := make(chan int)
+			var wg sync.WaitGroup
+			for w := 0; w < sizeProbeWorkers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range jobs {
+						sizes[i] = probeSize(pending[i].URL)
+					}
+				}()
+			}
+			for i := range pending {
+				jobs <- i
+			}
+			close(jobs)
+			wg.Wait()
+
+			fyne.Do(func() {
+				for i, link := range pending {
+					link.Size = sizes[i]
+				}
+				sizesBtn.Enable()
+				applyFilter()
+			})
+		}()
+	}
+
+	selectAll := widget.NewButton("All", func() {
+		for _, link := range visible {
+			link.Selected = true
+		}
+		list.Refresh()
+	})
+	selectNone := widget.NewButton("None", func() {
+		for _, link := range visible {
+			link.Selected = false
+		}
+		list.Refresh()
+	})
+
+	filters := container.NewGridWithColumns(4, extEntry, regexEntry, minEntry, maxEntry)
+	top := container.NewVBox(
+		container.NewBorder(nil, nil, nil, fetchBtn, pageEntry),
+		filters,
+		container.NewHBox(sizesBtn, widget.NewSeparator(), selectAll, selectNone, statusLabel),
+		widget.NewSeparator(),
+	)
+	content := container.NewBorder(top, nil, nil, nil, list)
+
+	grabDialog := dialog.NewCustomConfirm("Grab Links", "Add Selected", "Cancel", content, func(add bool) {
+		if !add {
+			return
+		}
+
+		var failed []string
+		for _, link := range visible {
+			if !link.Selected {
+				continue
+			}
+			if err := d.queueDownload(link.URL); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", link.URL, err))
+			}
+		}
+		if len(failed) > 0 {
+			dialog.ShowError(fmt.Errorf("Some links could not be added:\n%s",
+				strings.Join(failed, "\n")), d.window)
+		}
+	}, d.window)
+
+	grabDialog.Resize(fyne.NewSize(850, 600))
+	grabDialog.Show()
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// errNoInstance means nothing is listening on the handoff socket.
+var errNoInstance = errors.New("download manager is not running")
+
+// testHookNoInstance runs when a launch finds no instance to hand over to.
+var testHookNoInstance = func() {}
+
+// handoffRequest asks the running instance to queue downloads. It arrives
+// as one JSON line on the handoff socket.
+type handoffRequest struct {
+	URLs     []string          `json:"urls"`
+	Referrer string            `json:"referrer,omitempty"`
+	Cookies  string            `json:"cookies,omitempty"` // Cookie header value
+	Headers  map[string]string `json:"headers,omitempty"`
+	FileName string            `json:"fileName,omitempty"` // Only used with a single URL
+	Dir      string            `json:"dir,omitempty"`
+	Focus    bool              `json:"focus,omitempty"` // Bring the window to front
+}
+
+type handoffReply struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// handoffPath is the per-user socket a running instance listens on.
+func handoffPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "com.chunkeddownloader.app")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "handoff.sock"), nil
+}
+
+// claimInstance makes this process the single running instance. When one
+// is already running it hands req over to it instead and reports
+// handedOver. The returned listener is the lock: later launches reach us
+// through it.
+func claimInstance(req handoffRequest) (ln net.Listener, handedOver bool, err error) {
+	path, err := handoffPath()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := sendHandoff(req); err != errNoInstance {
+		return nil, true, err
+	}
+	testHookNoInstance()
+
+	// Launches that find nobody listening take turns, so only one of them
+	// clears a stale socket and listens
+	lock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, false, err
+	}
+	defer lock.Close()
+
+	// Whoever held the lock before us may be listening by now
+	if err := sendHandoff(req); err != errNoInstance {
+		return nil, true, err
+	}
+	// Nobody answers, so any socket file is left over from a crash
+	os.Remove(path)
+	ln, err = net.Listen("unix", path)
+	if err != nil {
+		return nil, false, err
+	}
+	return ln, false, nil
+}
+
+// serveHandoffs accepts requests from later launches and the native
+// messaging host.
+func (d *Downloader) serveHandoffs(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go d.serveHandoff(conn)
+	}
+}
+
+func (d *Downloader) serveHandoff(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var req handoffRequest
+	reply := handoffReply{OK: true}
+	if err := json.Unmarshal(line, &req); err != nil {
+		reply = handoffReply{Error: "invalid request: " + err.Error()}
+	} else if err := d.acceptHandoff(req); err != nil {
+		reply = handoffReply{Error: err.Error()}
+	}
+	data, _ := json.Marshal(reply)
+	conn.Write(append(data, '\n'))
+}
+
+// acceptHandoff queues each URL of req as its own task.
+func (d *Downloader) acceptHandoff(req handoffRequest) error {
+	if req.Focus {
+		fyne.Do(func() {
+			d.window.Show()
+			d.window.RequestFocus()
+		})
+	}
+	if len(req.URLs) == 0 {
+		if req.Focus {
+			return nil
+		}
+		return fmt.Errorf("no URL given")
+	}
+
+	// Applied on top of what the download rules set
+	opts := taskOptions{Dir: req.Dir, Headers: map[string]string{}}
+	for k, v := range req.Headers {
+		opts.Headers[k] = v
+	}
+	if req.Referrer != "" {
+		opts.Headers["Referer"] = req.Referrer
+	}
+	if req.Cookies != "" {
+		opts.Headers["Cookie"] = req.Cookies
+	}
+
+	var failed []string
+	for _, urlStr := range req.URLs {
+		_, err := d.addRemote([]string{urlStr}, func(task *DownloadTask) error {
+			opts.apply(task)
+			if req.FileName != "" && len(req.URLs) == 1 {
+				task.FileName = filepath.Base(req.FileName)
+			}
+			return nil
+		})
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// sendHandoff delivers req to the running instance.
+func sendHandoff(req handoffRequest) error {
+	path, err := handoffPath()
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return errNoInstance
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	data, _ := json.Marshal(req)
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	var reply handoffReply
+	if err := json.Unmarshal(line, &reply); err != nil {
+		return err
+	}
+	if !reply.OK {
+		return fmt.Errorf("%s", reply.Error)
+	}
+	return nil
+}
+
+// sendHandoffOrLaunch starts the app when no instance is running and waits
+// for it to take the request.
+func sendHandoffOrLaunch(req handoffRequest) error {
+	if err := sendHandoff(req); err != errNoInstance {
+		return err
+	}
+
+	// The new instance only needs to start; the request follows over the socket
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := exec.Command(exe).Start(); err != nil {
+		return fmt.Errorf("failed to start download manager: %v", err)
+	}
+
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		time.Sleep(500 * time.Millisecond)
+		err := sendHandoff(req)
+		if err != errNoInstance || time.Now().After(deadline) {
+			return err
+		}
+	}
+}
+
+const commandLineUsage = `usage: %s [URL...] [--out DIR]
+
+Queues the URLs in the running download manager, starting it if needed.
+  --out DIR, -o DIR   save these downloads in DIR
+`
+
+// parseCommandLine reads launch arguments into the request handed to the
+// running instance. Relative paths are resolved here, since the running
+// instance has its own working directory.
+func parseCommandLine(args []string) (handoffRequest, error) {
+	req := handoffRequest{Focus: true}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--out" || arg == "-o":
+			if i+1 >= len(args) {
+				return req, fmt.Errorf("%s needs a folder", arg)
+			}
+			i++
+			req.Dir = args[i]
+		case strings.HasPrefix(arg, "--out="):
+			req.Dir = strings.TrimPrefix(arg, "--out=")
+		case arg == "--":
+			req.URLs = append(req.URLs, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-"):
+			return req, fmt.Errorf("unknown option %s", arg)
+		default:
+			req.URLs = append(req.URLs, arg)
+		}
+	}
+
+	if req.Dir != "" {
+		dir, err := filepath.Abs(req.Dir)
+		if err != nil {
+			return req, err
+		}
+		req.Dir = dir
+	}
+	for i, u := range req.URLs {
+		// Local files given by relative path
+		if !strings.Contains(u, "://") && !strings.HasPrefix(u, "magnet:") && !strings.HasPrefix(u, "data:") {
+			if _, err := os.Stat(u); err == nil {
+				req.URLs[i], _ = filepath.Abs(u)
+			}
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"sync"
+	"testing"
+)
+
+// answerHandoffs accepts every request on ln without acting on it.
+func answerHandoffs(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			bufio.NewReader(conn).ReadBytes('\n')
+			conn.Write([]byte(`{"ok":true}` + "\n"))
+		}()
+	}
+}
+
+func TestClaimInstanceConcurrently(t *testing.T) {
+	// Socket paths are limited to about 100 bytes, so stay out of the
+	// long per-test temp directory
+	dir, err := os.MkdirTemp("", "handoff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	path, err := handoffPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testHookNoInstance = func() {} })
+
+	for round := 0; round < 10; round++ {
+		// Every other round starts from a socket a crashed instance left
+		if round%2 == 1 {
+			stale, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stale.(*net.UnixListener).SetUnlinkOnClose(false)
+			stale.Close()
+		}
+
+		const launches = 2
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			listeners []net.Listener
+			handed    int
+		)
+		// Hold every launch until all of them have found nobody listening
+		var arrived sync.WaitGroup
+		arrived.Add(launches)
+		testHookNoInstance = func() {
+			arrived.Done()
+			arrived.Wait()
+		}
+		start := make(chan struct{})
+		for range launches {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				ln, handedOver, err := claimInstance(handoffRequest{Focus: true})
+				if err != nil {
+					t.Errorf("round %d: %v", round, err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if handedOver {
+					handed++
+					return
+				}
+				listeners = append(listeners, ln)
+				go answerHandoffs(ln)
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if len(listeners) != 1 || handed != launches-1 {
+			t.Fatalf("round %d: %d instances claimed the socket and %d handed over, want 1 and %d",
+				round, len(listeners), handed, launches-1)
+		}
+		// The winner is the one later launches reach
+		if err := sendHandoff(handoffRequest{Focus: true}); err != nil {
+			t.Fatalf("round %d: running instance unreachable: %v", round, err)
+		}
+		listeners[0].Close()
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("round %d: socket left behind after close: %v", round, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// How often the watch folder is scanned. A file is picked up once it looks
+// the same on two scans in a row, so half-written files are left alone.
+const inboxInterval = 5 * time.Second
+
+// Biggest URL list we read from a dropped or watched file
+const maxListFile = 8 << 20
+
+type inboxStamp struct {
+	size int64
+	mod  time.Time
+}
+
+func inboxKind(name string) string {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".txt", ".metalink", ".meta4", ".torrent"} {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+func (d *Downloader) runInbox() {
+	seen := map[string]inboxStamp{}
+	ticker := time.NewTicker(inboxInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		dir := d.config().Inbox
+		if dir == "" {
+			clear(seen)
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+			if e.IsDir() || inboxKind(e.Name()) == "" {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+
+			// Failed before and not touched since
+			if errInfo, err := os.Stat(path + ".error"); err == nil && !errInfo.ModTime().Before(info.ModTime()) {
+				continue
+			}
+
+			stamp := inboxStamp{info.Size(), info.ModTime()}
+			if prev, ok := seen[path]; !ok || prev != stamp {
+				seen[path] = stamp
+				continue
+			}
+			delete(seen, path)
+			d.ingestInboxFile(path)
+		}
+	}
+}
+
+// ingestInboxFile queues what path describes and moves it to processed/.
+// A file that yields nothing stays put with a .error sidecar explaining
+// why; partial failures are noted next to the processed copy.
+func (d *Downloader) ingestInboxFile(path string) {
+	var queued int
+	var problems []string
+	var err error
+
+	switch inboxKind(path) {
+	case ".torrent":
+		// The torrent is read again when the task starts, so queue the
+		// processed copy rather than one about to move
+		if _, err = torrentSpec(fileURL(path)); err == nil {
+			var moved string
+			if moved, err = moveToProcessed(path); err == nil {
+				task := d.newUserTask(fileURL(moved))
+				fyne.Do(func() {
+					d.addTask(task)
+				})
+				return
+			}
+		}
+
+	case ".metalink", ".meta4":
+		var doc *metalinkDoc
+		data, readErr := readListFile(path)
+		err = readErr
+		if err == nil {
+			doc, err = parseMetalink(data)
+		}
+		if err == nil {
+			var tasks []*DownloadTask
+			for _, f := range doc.Files {
+				task, err := d.metalinkTask(f)
+				if err != nil {
+					problems = append(problems, err.Error())
+					continue
+				}
+				tasks = append(tasks, task)
+			}
+			queued = len(tasks)
+			fyne.Do(func() {
+				for _, task := range tasks {
+					d.addTask(task)
+				}
+			})
+		}
+
+	case ".txt":
+		var urls []string
+		data, readErr := readListFile(path)
+		err = readErr
+		if err == nil {
+			urls, err = parseURLList(string(data))
+		}
+		for _, u := range urls {
+			var qerr error
+			fyne.DoAndWait(func() {
+				qerr = d.queueDownload(u)
+			})
+			if qerr != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", u, qerr))
+				continue
+			}
+			queued++
+		}
+	}
+
+	if err == nil && queued == 0 {
+		err = fmt.Errorf("nothing to download")
+		if len(problems) > 0 {
+			err = fmt.Errorf("nothing could be queued:\n%s", strings.Join(problems, "\n"))
+		}
+	}
+	if err != nil {
+		os.WriteFile(path+".error", []byte(err.Error()+"\n"), 0644)
+		return
+	}
+
+	moved, err := moveToProcessed(path)
+	if err != nil {
+		os.WriteFile(path+".error", []byte(err.Error()+"\n"), 0644)
+		return
+	}
+	if len(problems) > 0 {
+		os.WriteFile(moved+".error", []byte(strings.Join(problems, "\n")+"\n"), 0644)
+	}
+}
+
+func readListFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, maxListFile))
+}
+
+// moveToProcessed moves path into the processed subfolder, keeping earlier
+// files of the same name, and drops any stale sidecar.
+func moveToProcessed(path string) (string, error) {
+	dir := filepath.Join(filepath.Dir(path), "processed")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(path)
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(name)
+		target = filepath.Join(dir, strings.TrimSuffix(name, ext)+time.Now().Format(".20060102-150405")+ext)
+	}
+	if err := os.Rename(path, target); err != nil {
+		return "", err
+	}
+	os.Remove(path + ".error")
+	return target, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+)
+
+func init() {
+	sources["file"] = fileSource{}
+}
+
+// fileSource copies local files through the normal chunk pipeline so they
+// get progress, checksums and the usual completion handling.
+type fileSource struct{}
+
+// localPath turns a file:// URL back into a native path.
+func localPath(u *url.URL) string {
+	p := u.Path
+	if p == "" {
+		p = u.Opaque
+	}
+	// file:///C:/dir on Windows
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+// fileURL turns an absolute path into a file:// URL.
+func fileURL(p string) string {
+	slashed := filepath.ToSlash(p)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	u := url.URL{Scheme: "file", Path: slashed}
+	return u.String()
+}
+
+func (fileSource) stat(u *url.URL) (int64, string, error) {
+	info, err := os.Stat(localPath(u))
+	if err != nil {
+		return 0, "", err
+	}
+	if info.IsDir() {
+		return 0, "", fmt.Errorf("%s is a folder", localPath(u))
+	}
+	return info.Size(), info.Name(), nil
+}
+
+func (fileSource) openRange(u *url.URL, start, end int64) (io.ReadCloser, error) {
+	file, err := os.Open(localPath(u))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return newRangeReader(file, start, end, file.Close), nil
+}
+
+// Preferred extensions where the system table offers several.
+var dataExtensions = map[string]string{
+	"text/plain": ".txt",
+	"image/jpeg": ".jpg",
+	"text/html":  ".html",
+}
+
+func isDataURL(urlStr string) bool {
+	return len(urlStr) >= 5 && strings.EqualFold(urlStr[:5], "data:")
+}
+
+// decodeDataURL returns the payload and media type of a data: URL.
+func decodeDataURL(u *url.URL) ([]byte, string, error) {
+	// Opaque stops at ? and #, both of which are legal in the payload
+	raw := strings.TrimPrefix(u.String(), u.Scheme+":")
+
+	header, payload, ok := strings.Cut(raw, ",")
+	if !ok {
+		return nil, "", fmt.Errorf("invalid data URL: missing comma")
+	}
+
+	mediaType := "text/plain"
+	isBase64 := false
+	for i, param := range strings.Split(header, ";") {
+		switch {
+		case i == 0 && param != "":
+			mediaType = param
+		case strings.EqualFold(param, "base64"):
+			isBase64 = true
+		}
+	}
+
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid data URL: %v", err)
+	}
+	if !isBase64 {
+		return []byte(data), mediaType, nil
+	}
+
+	// Tolerate line breaks and missing padding from copy/paste
+	data = strings.Join(strings.Fields(data), "")
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid base64 in data URL: %v", err)
+	}
+	return decoded, mediaType, nil
+}
+
+// decodeDataTask decodes a data: URL onto its task and names the file
+// after a hash of its contents so different data URLs never overwrite each
+// other.
+func (d *Downloader) decodeDataTask(task *DownloadTask) error {
+	u, err := url.Parse(task.URL)
+	if err != nil {
+		return err
+	}
+	data, mediaType, err := decodeDataURL(u)
+	if err != nil {
+		return err
+	}
+
+	ext := ".bin"
+	if base, _, err := mime.ParseMediaType(mediaType); err == nil {
+		if preferred, ok := dataExtensions[base]; ok {
+			ext = preferred
+		} else if exts, _ := mime.ExtensionsByType(base); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	sum := sha256.Sum256(data)
+	name := "data_" + hex.EncodeToString(sum[:6]) + ext
+	if task.FileName != "" {
+		name = task.FileName
+	}
+
+	task.data = data
+	task.TotalSize = int64(len(data))
+	task.OutputFile = filepath.Join(d.taskFolder(task), filepath.Base(name))
+	return nil
+}
+
+// saveData writes a data: URL's payload straight to the output file. Tasks
+// added by other routes, such as RPC, are decoded here.
+func (d *Downloader) saveData(task *DownloadTask) {
+	if task.data == nil {
+		if err := d.decodeDataTask(task); err != nil {
+			d.failDownload(task, err)
+			return
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(task.OutputFile), 0755)
+	if err == nil {
+		err = os.WriteFile(task.OutputFile, task.data, 0644)
+	}
+	if err != nil {
+		d.failDownload(task, err)
+		return
+	}
+
+	task.mu.Lock()
+	task.Downloaded = task.TotalSize
+	task.mu.Unlock()
+	fileName := filepath.Base(task.OutputFile)
+	fyne.Do(func() {
+		task.fileNameLabel.SetText(fileName)
+	})
+	d.finishDownload(task)
+}
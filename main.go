@@ -16,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"image/color"
@@ -28,14 +29,17 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/anacrolix/torrent"
 )
 
 type ChunkInfo struct {
-	Index    int
-	Start    int64
-	End      int64
-	Progress float64
-	Status   string
+	Index      int
+	Start      int64
+	End        int64
+	Progress   float64
+	Status     string
+	Downloaded int64
+	Mirror     string // URL this chunk is being fetched from
 }
 
 type DownloadTask struct {
@@ -52,6 +56,33 @@ type DownloadTask struct {
 	StartTime      time.Time
 	MD5Hash        string
 	SHA256Hash     string
+	ETag           string
+	LastModified   string
+	Mirrors        []string          // Alternative URLs serving the same file
+	ExpectedHashes map[string]string // Whole-file hashes by type, e.g. "sha-256"
+	PieceLength    int64
+	PieceHashType  string
+	PieceHashes    []string
+	infoKnown      bool // Name and size came from metadata, skip probing the server
+	mirrorStats    map[string]*mirrorStat
+	stream         *streamInfo       // Set for HLS/DASH downloads
+	data           []byte            // Decoded payload of a data: URL
+	OutputDir      string            // Overrides the output folder when set
+	FileName       string            // Overrides the name the server suggests
+	Headers        map[string]string // Extra HTTP request headers, e.g. Referer and Cookie
+	Connections    int               // Chunks fetched at once; 0 uses defaultConnections
+	Priority       int               // priorityLow, priorityNormal or priorityHigh
+	held           bool              // Added paused and not started yet
+	Proxy          string            // Proxy URL for HTTP requests, e.g. socks5://127.0.0.1:1080
+	OpenFolder     bool              // Show the file in its folder once done
+	OnComplete     string            // Command run once the file is done
+	limiter        *rateLimiter      // Per-task speed cap, nil for none
+	site           *siteMirror       // Set on the parent task of a site mirror
+	watch          *watchSpec        // Set for recurring downloads
+	onVerified     func() error      // Runs once the file passes its checks, before it counts as done
+	parent         *DownloadTask
+	children       []*DownloadTask
+	childList      *fyne.Container
 	progressBar    *widget.ProgressBar
 	statusLabel    *widget.Label
 	speedLabel     *widget.Label
@@ -64,19 +95,68 @@ type DownloadTask struct {
 	cancelFunc     func()
 }
 
+// Keeps task IDs unique when many tasks are created in the same instant
+var taskSeq atomic.Int64
+
 type Downloader struct {
-	app           fyne.App
-	window        fyne.Window
-	tasks         map[string]*DownloadTask
-	taskContainer *container.Scroll
-	taskList      *fyne.Container
-	urlEntry      *widget.Entry
-	addButton     *widget.Button
-	clearButton   *widget.Button
-	statsLabel    *widget.Label
-	outputFolder  string
-	chunkCount    int
-	mu            sync.Mutex
+	app            fyne.App
+	window         fyne.Window
+	tasks          map[string]*DownloadTask
+	taskContainer  *container.Scroll
+	taskList       *fyne.Container
+	urlEntry       *widget.Entry
+	addButton      *widget.Button
+	clearButton    *widget.Button
+	statsLabel     *widget.Label
+	outputFolder   string
+	chunkCount     int
+	torrentClient  *torrent.Client
+	outputHistory  map[string]outputRecord // Validators of completed downloads
+	scheduler      *scheduler
+	limiter        *rateLimiter
+	rpcServer      *http.Server // JSON-RPC and REST control server, nil when off
+	webServer      *http.Server // Browser interface, nil when off
+	clipboard      *clipboardWatcher
+	clipboardBar   *fyne.Container // "Download this?" banner for copied links
+	clipboardLabel *widget.Label
+	settings       appSettings // Guarded by mu; read it through config
+	mu             sync.Mutex
+}
+
+// appSettings holds the options that background goroutines and the
+// control servers read while the Settings dialog may be changing them.
+type appSettings struct {
+	Clipboard  clipboardSettings
+	Inbox      string  // Watched folder; empty turns the inbox off
+	SeedRatio  float64 // Upload/download ratio after which torrents stop seeding; 0 disables seeding
+	SpeedLimit int64   // KB/s for all downloads together when the schedule sets none; 0 is unlimited
+	S3         s3Settings
+	SSHKeyFile string // Extra private key for sftp:// and scp://
+	RPC        rpcSettings
+	Web        webSettings
+}
+
+func defaultSettings() appSettings {
+	return appSettings{
+		Clipboard: clipboardSettings{Patterns: defaultClipboardPatterns},
+		SeedRatio: 1.0,
+		RPC:       rpcSettings{Port: 6800},
+		Web:       webSettings{Port: 6880},
+	}
+}
+
+// config returns a copy of the current settings.
+func (d *Downloader) config() appSettings {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.settings
+}
+
+// setConfig changes the settings under d.mu.
+func (d *Downloader) setConfig(change func(*appSettings)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	change(&d.settings)
 }
 
 func NewDownloader() *Downloader {
@@ -96,14 +176,33 @@ func NewDownloader() *Downloader {
 		tasks:        make(map[string]*DownloadTask),
 		outputFolder: defaultOutput,
 		chunkCount:   10, // Default 10 chunks
+		scheduler:    newScheduler(),
+		limiter:      &rateLimiter{},
+		clipboard:    newClipboardWatcher(),
+		settings:     defaultSettings(),
 	}
 
+	// Backends that need the credentials from the settings
+	sources["s3"] = s3Source{d}
+	sources["sftp"] = sftpSource{d}
+	// scp:// is served over the SFTP subsystem, which SCP itself lacks the
+	// ranged reads for
+	sources["scp"] = sftpSource{d}
+
 	// Load saved settings
 	d.loadSettings()
+	d.loadOutputHistory()
 
 	myWindow.SetContent(d.createUI())
+	myWindow.SetOnDropped(d.handleDrop)
 	myWindow.CenterOnScreen()
 
+	go d.runScheduler()
+	go d.startRPC()
+	go d.startWebUI()
+	go d.runClipboardWatch()
+	go d.runInbox()
+
 	return d
 }
 
@@ -115,16 +214,36 @@ func (d *Downloader) createUI() fyne.CanvasObject {
 	d.addButton = widget.NewButtonWithIcon("Add Download", theme.DownloadIcon(), d.addDownload)
 	d.addButton.Importance = widget.HighImportance
 
+	optionsBtn := widget.NewButtonWithIcon("", theme.MoreHorizontalIcon(), d.showAddWithOptions)
+	optionsBtn.Importance = widget.LowImportance
+
 	// Icon-only control buttons
 	d.clearButton = widget.NewButtonWithIcon("", theme.DeleteIcon(), d.clearCompleted)
 	d.clearButton.Importance = widget.LowImportance
 
+	batchBtn := widget.NewButtonWithIcon("", theme.ListIcon(), d.showBatchAdd)
+	batchBtn.Importance = widget.LowImportance
+
+	grabBtn := widget.NewButtonWithIcon("", theme.SearchIcon(), d.showGrabLinks)
+	grabBtn.Importance = widget.LowImportance
+
+	mirrorBtn := widget.NewButtonWithIcon("", theme.StorageIcon(), d.showSiteMirror)
+	mirrorBtn.Importance = widget.LowImportance
+
+	watchBtn := widget.NewButtonWithIcon("", theme.HistoryIcon(), d.showWatchDialog)
+	watchBtn.Importance = widget.LowImportance
+
 	settingsBtn := widget.NewButtonWithIcon("", theme.SettingsIcon(), d.showSettings)
 	settingsBtn.Importance = widget.LowImportance
 
 	// Group all buttons together
 	buttonGroup := container.NewHBox(
 		d.addButton,
+		optionsBtn,
+		batchBtn,
+		grabBtn,
+		mirrorBtn,
+		watchBtn,
 		d.clearButton,
 		settingsBtn,
 	)
@@ -158,6 +277,7 @@ func (d *Downloader) createUI() fyne.CanvasObject {
 	content := container.NewBorder(
 		container.NewVBox(
 			container.NewPadded(inputSection),
+			d.createClipboardBanner(),
 			statsSection,
 			widget.NewSeparator(),
 		),
@@ -177,35 +297,109 @@ func (d *Downloader) addDownload() {
 		return
 	}
 
+	if err := d.queueDownload(urlStr); err != nil {
+		dialog.ShowError(err, d.window)
+		return
+	}
+
+	// Clear entry
+	d.urlEntry.SetText("")
+}
+
+// queueDownload validates urlStr, creates a task for it and starts downloading.
+func (d *Downloader) queueDownload(urlStr string) error {
+	// Bare local paths are copied like file:// URLs
+	if filepath.IsAbs(urlStr) {
+		urlStr = fileURL(urlStr)
+	}
+
 	// Validate URL
 	if _, err := url.Parse(urlStr); err != nil {
-		dialog.ShowError(fmt.Errorf("Invalid URL: %v", err), d.window)
-		return
+		return fmt.Errorf("Invalid URL: %v", err)
+	}
+
+	// data: URLs carry the file itself; decode it once up front
+	if isDataURL(urlStr) {
+		task := d.newUserTask(urlStr)
+		if err := d.decodeDataTask(task); err != nil {
+			return err
+		}
+		d.addTask(task)
+		return nil
+	}
+
+	// Torrents resolve their own name and size once metadata arrives
+	if isTorrentURL(urlStr) {
+		d.addTask(d.newUserTask(urlStr))
+		return nil
+	}
+
+	if isMetalinkURL(urlStr) {
+		go d.queueMetalink(urlStr)
+		return nil
+	}
+
+	if isStreamURL(urlStr) {
+		go d.queueStream(urlStr)
+		return nil
+	}
+
+	if lister, ok := sourceFor(urlStr).(directorySource); ok {
+		go d.queueListing(urlStr, lister)
+		return nil
+	}
+
+	// Folder URLs on a WebDAV server download the whole tree
+	if isHTTPFolderURL(urlStr) {
+		go d.queueListing(urlStr, webdavSource{})
+		return nil
 	}
 
-	// Create new download task
-	taskID := fmt.Sprintf("task_%d", time.Now().UnixNano())
-	task := &DownloadTask{
-		ID:         taskID,
+	d.addTask(d.newUserTask(urlStr))
+	return nil
+}
+
+func (d *Downloader) newTask(urlStr string) *DownloadTask {
+	return &DownloadTask{
+		ID:         fmt.Sprintf("task_%d_%d", time.Now().UnixNano(), taskSeq.Add(1)),
 		URL:        urlStr,
 		Status:     "Preparing...",
 		ChunkCount: d.chunkCount,
 		StartTime:  time.Now(),
 	}
+}
 
+// addTask shows task in the list and starts it. Must be called on the UI
+// thread; background callers wrap it in fyne.Do.
+func (d *Downloader) addTask(task *DownloadTask) {
 	// Create UI for task
 	task.createTaskUI(d)
 
 	// Add to tasks
 	d.mu.Lock()
-	d.tasks[taskID] = task
+	d.tasks[task.ID] = task
 	d.mu.Unlock()
 
 	// Add to UI
 	d.taskList.Add(task.container)
 
-	// Clear entry
-	d.urlEntry.SetText("")
+	if task.held {
+		task.Status = "Paused"
+		task.updateStatusDisplay()
+		task.speedLabel.SetText("Not started")
+		task.actionButton.SetIcon(theme.MediaPlayIcon())
+		d.updateStats()
+		return
+	}
+
+	// Outside the schedule's windows the task waits its turn
+	if d.scheduler.holding() {
+		task.Status = "Scheduled"
+		task.updateStatusDisplay()
+		task.speedLabel.SetText("Waiting for download window")
+		d.updateStats()
+		return
+	}
 
 	// Start download
 	go d.startDownload(task)
@@ -248,6 +442,9 @@ func (task *DownloadTask) createTaskUI(d *Downloader) {
 		if task.Status == "Downloading" {
 			task.Status = "Paused"
 			task.actionButton.SetIcon(theme.MediaPlayIcon())
+		} else if task.held {
+			// Added paused: this is its first start
+			d.startHeld(task)
 		} else if task.Status == "Paused" {
 			task.Status = "Downloading"
 			task.actionButton.SetIcon(theme.MediaPauseIcon())
@@ -286,6 +483,13 @@ func (task *DownloadTask) createTaskUI(d *Downloader) {
 		task.actionButton,
 		removeBtn,
 	)
+	if task.watch != nil {
+		historyBtn := widget.NewButtonWithIcon("", theme.HistoryIcon(), func() {
+			d.showWatchHistory(task)
+		})
+		historyBtn.Importance = widget.LowImportance
+		actions.Add(historyBtn)
+	}
 
 	// Main content layout
 	mainContent := container.NewBorder(
@@ -300,11 +504,53 @@ func (task *DownloadTask) createTaskUI(d *Downloader) {
 	paddedContent := container.NewPadded(mainContent)
 	task.container = container.NewStack(cardBg, paddedContent)
 	task.container = container.NewPadded(task.container)
+
+	// Site mirrors list their files indented below the card
+	if task.site != nil {
+		indent := canvas.NewRectangle(color.Transparent)
+		indent.SetMinSize(fyne.NewSize(24, 0))
+		task.childList = container.NewVBox()
+		task.container = container.NewVBox(task.container,
+			container.NewBorder(nil, nil, indent, nil, task.childList))
+	}
 }
 
 func (d *Downloader) startDownload(task *DownloadTask) {
-	// Get file info
-	err := d.getFileInfo(task)
+	if task.site != nil {
+		d.runSiteMirror(task)
+		return
+	}
+
+	if isTorrentURL(task.URL) {
+		d.downloadTorrent(task)
+		return
+	}
+
+	if task.watch != nil {
+		d.runWatch(task)
+		return
+	}
+
+	if isDataURL(task.URL) {
+		d.saveData(task)
+		return
+	}
+
+	d.downloadFile(task)
+}
+
+// downloadFile fetches one file through the chunk pipeline.
+func (d *Downloader) downloadFile(task *DownloadTask) {
+	// Get file info; metalink tasks already know name and size
+	var err error
+	if task.infoKnown {
+		err = os.MkdirAll(filepath.Dir(task.OutputFile), 0755)
+	} else {
+		err = d.getFileInfo(task)
+	}
+	if err == nil && len(task.Mirrors) > 1 {
+		err = d.checkMirrors(task)
+	}
 	if err != nil {
 		task.Status = "Failed"
 		fyne.Do(func() {
@@ -314,6 +560,12 @@ func (d *Downloader) startDownload(task *DownloadTask) {
 		return
 	}
 
+	// Same URL and path as an earlier download: revalidate instead
+	if !task.infoKnown && d.notModified(task) {
+		d.markUpToDate(task)
+		return
+	}
+
 	// Update UI with file info
 	fileName := filepath.Base(task.OutputFile)
 	fyne.Do(func() {
@@ -329,17 +581,26 @@ func (d *Downloader) startDownload(task *DownloadTask) {
 	// Start downloading
 	task.Status = "Downloading"
 	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, 3) // Limit concurrent chunks
+	semaphore := make(chan struct{}, task.connections()) // Limit concurrent chunks
 
 	for i := range task.Chunks {
 		wg.Add(1)
 		go func(chunk *ChunkInfo) {
 			defer wg.Done()
 			semaphore <- struct{}{}
-			d.downloadChunk(task, chunk)
+			if task.stream != nil {
+				d.downloadSegment(task, chunk)
+			} else if len(task.Mirrors) > 1 {
+				d.downloadChunkFromMirrors(task, chunk)
+			} else {
+				d.downloadChunk(task, chunk)
+			}
 			<-semaphore
 		}(&task.Chunks[i])
-		time.Sleep(200 * time.Millisecond)
+		// Streams have hundreds of small segments; the semaphore paces them
+		if task.stream == nil {
+			time.Sleep(200 * time.Millisecond)
+		}
 	}
 
 	// Monitor progress
@@ -356,57 +617,115 @@ func (d *Downloader) startDownload(task *DownloadTask) {
 		}
 	}
 
-	if successCount < len(task.Chunks)/2 {
-		// Fallback to single download
-		d.downloadSingleFile(task)
+	if task.Status == "Cancelled" {
 		return
 	}
 
-	if successCount == len(task.Chunks) {
-		// Merge chunks
+	switch {
+	case successCount < len(task.Chunks)/2 && task.stream == nil:
+		// Fallback to single download
+		err = d.downloadSingleFile(task)
+	case successCount == len(task.Chunks):
 		err = d.mergeChunks(task)
+	default:
+		err = fmt.Errorf("%d of %d chunks failed", len(task.Chunks)-successCount, len(task.Chunks))
+	}
+	if task.Status == "Cancelled" {
+		return
+	}
+	if err != nil {
+		d.failDownload(task, err)
+		return
+	}
+	d.finishDownload(task)
+}
+
+// finishDownload checks the assembled file's size and hashes. Only a file
+// that passes is marked Completed, remembered for revalidation and handed
+// to the rule's post-download actions.
+func (d *Downloader) finishDownload(task *DownloadTask) {
+	// A missing part or a connection cut short leaves the file too small.
+	// Stream sizes are not known up front.
+	if task.TotalSize > 0 && task.stream == nil {
+		info, err := os.Stat(task.OutputFile)
 		if err != nil {
-			task.Status = "Failed"
-			fyne.Do(func() {
-				task.updateStatusDisplay()
-				task.actionButton.SetIcon(theme.ViewRefreshIcon())
-			})
+			d.failDownload(task, err)
+			return
+		}
+		if info.Size() != task.TotalSize {
+			d.failDownload(task, fmt.Errorf("Incomplete file: %d of %d bytes", info.Size(), task.TotalSize))
 			return
 		}
+	}
 
-		// Calculate checksums
-		d.calculateChecksums(task)
+	// Pieces were checked per chunk, but the single-stream fallback
+	// wrote the file in one go
+	if len(task.PieceHashes) > 0 && !d.verifyFilePieces(task) {
+		d.failDownload(task, fmt.Errorf("Corrupted pieces"))
+		return
+	}
 
-		task.Status = "Completed"
-		fyne.Do(func() {
-			task.progressBar.SetValue(1.0)
-			task.updateStatusDisplay()
-			task.actionButton.SetIcon(theme.FolderOpenIcon())
-			// Create a new closure to capture the downloader reference
-			localD := d
-			task.actionButton.OnTapped = func() {
-				// Open file location
-				localD.openFileLocation(task.OutputFile)
-			}
-		})
-	} else {
-		task.Status = "Failed"
-		fyne.Do(func() {
-			task.updateStatusDisplay()
-			task.actionButton.SetIcon(theme.ViewRefreshIcon())
-		})
+	// Calculate checksums
+	d.calculateChecksums(task)
+
+	if err := d.verifyExpectedHashes(task); err != nil {
+		d.failDownload(task, err)
+		return
 	}
 
+	if task.onVerified != nil {
+		if err := task.onVerified(); err != nil {
+			d.failDownload(task, err)
+			return
+		}
+	}
+
+	task.Status = "Completed"
+	d.rememberOutput(task)
+	d.runPostActions(task)
+	fyne.Do(func() {
+		task.progressBar.SetValue(1.0)
+		task.updateStatusDisplay()
+		task.actionButton.SetIcon(theme.FolderOpenIcon())
+		// Create a new closure to capture the downloader reference
+		localD := d
+		task.actionButton.OnTapped = func() {
+			// Open file location
+			localD.openFileLocation(task.OutputFile)
+		}
+	})
+	d.updateStats()
+}
+
+// failDownload marks task Failed, showing err under the progress bar.
+func (d *Downloader) failDownload(task *DownloadTask, err error) {
+	task.Status = "Failed"
+	fyne.Do(func() {
+		task.updateStatusDisplay()
+		task.speedLabel.SetText(err.Error())
+		task.actionButton.SetIcon(theme.ViewRefreshIcon())
+	})
 	d.updateStats()
 }
 
 func (d *Downloader) getFileInfo(task *DownloadTask) error {
+	if src := sourceFor(task.URL); src != nil {
+		return d.getSourceFileInfo(task, src)
+	}
+
 	client := &http.Client{
 		Timeout: 30 * time.Second,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return nil
 		},
 	}
+	if task.Proxy != "" {
+		transport := &http.Transport{}
+		if err := setProxy(transport, task.Proxy); err != nil {
+			return err
+		}
+		client.Transport = transport
+	}
 
 	req, err := http.NewRequest("HEAD", task.URL, nil)
 	if err != nil {
@@ -414,6 +733,7 @@ func (d *Downloader) getFileInfo(task *DownloadTask) error {
 	}
 
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	setHeaders(req, task.Headers)
 
 	resp, err := client.Do(req)
 	if err != nil || resp.StatusCode != http.StatusOK {
@@ -421,6 +741,7 @@ func (d *Downloader) getFileInfo(task *DownloadTask) error {
 		req, _ = http.NewRequest("GET", task.URL, nil)
 		req.Header.Set("Range", "bytes=0-0")
 		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+		setHeaders(req, task.Headers)
 		resp, err = client.Do(req)
 		if err != nil {
 			return err
@@ -428,6 +749,9 @@ func (d *Downloader) getFileInfo(task *DownloadTask) error {
 	}
 	defer resp.Body.Close()
 
+	task.ETag = resp.Header.Get("ETag")
+	task.LastModified = resp.Header.Get("Last-Modified")
+
 	// Get size
 	if cl := resp.Header.Get("Content-Length"); cl != "" {
 		task.TotalSize, _ = strconv.ParseInt(cl, 10, 64)
@@ -450,18 +774,53 @@ func (d *Downloader) getFileInfo(task *DownloadTask) error {
 		}
 	}
 
+	if task.FileName != "" {
+		task.OutputFile = task.FileName
+	}
+
 	// Set full path with output folder
-	task.OutputFile = filepath.Join(d.outputFolder, task.OutputFile)
+	folder := d.taskFolder(task)
+	task.OutputFile = filepath.Join(folder, filepath.Base(task.OutputFile))
 
 	// Ensure output folder exists
-	if err := os.MkdirAll(d.outputFolder, 0755); err != nil {
+	if err := os.MkdirAll(folder, 0755); err != nil {
 		return fmt.Errorf("failed to create output folder: %v", err)
 	}
 
 	return nil
 }
 
+// taskFolder is where a task saves its file.
+func (d *Downloader) taskFolder(task *DownloadTask) string {
+	if task.OutputDir != "" {
+		return task.OutputDir
+	}
+	return d.outputFolder
+}
+
 func (d *Downloader) initializeChunks(task *DownloadTask) {
+	if task.stream != nil {
+		d.initializeStreamChunks(task)
+		return
+	}
+
+	if task.PieceLength > 0 {
+		d.initializePieceChunks(task)
+		return
+	}
+
+	// Without a size the file can only be fetched as one stream
+	if task.TotalSize <= 0 {
+		task.ChunkCount = 1
+		task.Chunks = []ChunkInfo{{Index: 0, Start: 0, End: -1, Status: "Pending"}}
+		return
+	}
+
+	// Tiny files get at most one chunk per byte
+	if int64(task.ChunkCount) > task.TotalSize {
+		task.ChunkCount = int(task.TotalSize)
+	}
+
 	chunkSize := task.TotalSize / int64(task.ChunkCount)
 	task.Chunks = make([]ChunkInfo, task.ChunkCount)
 
@@ -482,33 +841,13 @@ func (d *Downloader) initializeChunks(task *DownloadTask) {
 }
 
 func (d *Downloader) downloadChunk(task *DownloadTask, chunk *ChunkInfo) {
-	client := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:    10,
-			IdleConnTimeout: 30 * time.Second,
-		},
-	}
-
-	req, err := http.NewRequest("GET", task.URL, nil)
+	chunkURL := task.chunkURL(chunk)
+	body, err := openTaskRange(task, chunkURL, chunk.Start, chunk.End)
 	if err != nil {
 		chunk.Status = "Failed"
 		return
 	}
-
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", chunk.Start, chunk.End))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		chunk.Status = "Failed"
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-		chunk.Status = "Failed"
-		return
-	}
+	defer func() { body.Close() }()
 
 	tempFile := fmt.Sprintf("%s.part%d", task.OutputFile, chunk.Index)
 	file, err := os.Create(tempFile)
@@ -521,13 +860,18 @@ func (d *Downloader) downloadChunk(task *DownloadTask, chunk *ChunkInfo) {
 	buffer := make([]byte, 32*1024)
 	totalBytes := chunk.End - chunk.Start + 1
 	downloaded := int64(0)
+	chunk.Downloaded = 0
 
 	for {
-		n, err := resp.Body.Read(buffer)
+		n, err := body.Read(buffer)
 		if n > 0 {
 			file.Write(buffer[:n])
+			d.throttle(task, n)
 			downloaded += int64(n)
-			chunk.Progress = float64(downloaded) / float64(totalBytes)
+			chunk.Downloaded = downloaded
+			if totalBytes > 0 {
+				chunk.Progress = float64(downloaded) / float64(totalBytes)
+			}
 
 			task.mu.Lock()
 			task.Downloaded += int64(n)
@@ -550,6 +894,35 @@ func (d *Downloader) downloadChunk(task *DownloadTask, chunk *ChunkInfo) {
 		if task.Status == "Cancelled" {
 			return
 		}
+
+		// Don't hold the connection open while paused
+		if task.Status == "Paused" {
+			body.Close()
+			if !waitResume(task) {
+				return
+			}
+			if totalBytes > 0 && downloaded >= totalBytes {
+				break
+			}
+			body, err = openTaskRange(task, chunkURL, chunk.Start+downloaded, chunk.End)
+			if err != nil {
+				chunk.Status = "Failed"
+				return
+			}
+		}
+	}
+
+	// Check piece hashes and refetch any corrupted pieces
+	if len(task.PieceHashes) > 0 && !d.verifyChunkPieces(task, chunk) {
+		chunk.Status = "Failed"
+		return
+	}
+
+	if task.stream != nil {
+		if err := d.decryptSegment(task, chunk); err != nil {
+			chunk.Status = "Failed"
+			return
+		}
 	}
 
 	chunk.Status = "Completed"
@@ -561,38 +934,96 @@ func (d *Downloader) downloadChunk(task *DownloadTask, chunk *ChunkInfo) {
 	})
 }
 
-func (d *Downloader) downloadSingleFile(task *DownloadTask) {
-	client := &http.Client{}
+// openHTTPRange requests bytes start-end of urlStr, or everything from
+// start when end is negative. header may add request headers and proxy route them.
+func openHTTPRange(urlStr string, start, end int64, header map[string]string, proxy string) (io.ReadCloser, error) {
+	transport := &http.Transport{
+		MaxIdleConns:    10,
+		IdleConnTimeout: 30 * time.Second,
+	}
+	if proxy != "" {
+		if err := setProxy(transport, proxy); err != nil {
+			return nil, err
+		}
+	}
+	client := &http.Client{Transport: transport}
 
-	req, err := http.NewRequest("GET", task.URL, nil)
+	req, err := http.NewRequest("GET", urlStr, nil)
 	if err != nil {
-		task.Status = "Failed"
-		return
+		return nil, err
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0")
+	if end >= 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	} else if start > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	setHeaders(req, header)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		task.Status = "Failed"
-		return
+		return nil, err
 	}
-	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	// A server ignoring Range would send the whole file from byte 0
+	if resp.StatusCode == http.StatusOK && start > 0 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("server does not support ranges")
+	}
+
+	return resp.Body, nil
+}
+
+// setHeaders adds a task's extra headers, which win over our defaults.
+func setHeaders(req *http.Request, header map[string]string) {
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+}
+
+// downloadSingleFile fetches the whole file in one request, for servers
+// that failed most chunk requests. The caller verifies the result.
+func (d *Downloader) downloadSingleFile(task *DownloadTask) error {
+	// Clean up whatever the failed chunks left behind
+	for i := range task.Chunks {
+		os.Remove(fmt.Sprintf("%s.part%d", task.OutputFile, i))
+	}
+	task.mu.Lock()
+	task.Downloaded = 0
+	task.mu.Unlock()
+
+	body, err := openTaskRange(task, task.URL, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer func() { body.Close() }()
 
 	file, err := os.Create(task.OutputFile)
 	if err != nil {
-		task.Status = "Failed"
-		return
+		return err
 	}
 	defer file.Close()
 
 	buffer := make([]byte, 32*1024)
 	for {
-		n, err := resp.Body.Read(buffer)
+		n, err := body.Read(buffer)
 		if n > 0 {
-			file.Write(buffer[:n])
+			if _, werr := file.Write(buffer[:n]); werr != nil {
+				return werr
+			}
+			d.throttle(task, n)
+			task.mu.Lock()
 			task.Downloaded += int64(n)
-			task.Progress = float64(task.Downloaded) / float64(task.TotalSize)
+			task.mu.Unlock()
+			if task.TotalSize > 0 {
+				task.Progress = float64(task.Downloaded) / float64(task.TotalSize)
+			}
 			fyne.Do(func() {
 				task.progressBar.SetValue(task.Progress)
 			})
@@ -601,9 +1032,52 @@ func (d *Downloader) downloadSingleFile(task *DownloadTask) {
 		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return err
+		}
+		if task.Status == "Cancelled" {
+			return nil
+		}
+
+		if task.Status == "Paused" {
+			body.Close()
+			if !waitResume(task) {
+				return nil
+			}
+			if body, err = d.reopenSingleFile(task, file); err != nil {
+				return err
+			}
+		}
 	}
+	return file.Close()
+}
 
-	task.Status = "Completed"
+// reopenSingleFile continues a paused single-stream download, or starts it
+// over when the server can't resume.
+func (d *Downloader) reopenSingleFile(task *DownloadTask, file *os.File) (io.ReadCloser, error) {
+	task.mu.Lock()
+	offset := task.Downloaded
+	task.mu.Unlock()
+	if body, err := openTaskRange(task, task.URL, offset, -1); err == nil {
+		return body, nil
+	}
+
+	body, err := openTaskRange(task, task.URL, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(0); err != nil {
+		body.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		body.Close()
+		return nil, err
+	}
+	task.mu.Lock()
+	task.Downloaded = 0
+	task.mu.Unlock()
+	return body, nil
 }
 
 func (d *Downloader) mergeChunks(task *DownloadTask) error {
@@ -653,6 +1127,10 @@ func (task *DownloadTask) updateStatusDisplay() {
 		statusText = fmt.Sprintf("%s | %d chunks", statusText, task.ChunkCount)
 	}
 
+	if len(task.Mirrors) > 1 {
+		statusText = fmt.Sprintf("%s | %d mirrors", statusText, len(task.activeMirrors()))
+	}
+
 	task.statusLabel.SetText(statusText)
 }
 
@@ -679,6 +1157,10 @@ func (d *Downloader) monitorProgress(task *DownloadTask) {
 	lastDownloaded := int64(0)
 
 	for range ticker.C {
+		// Paused tasks resume later, so keep watching them
+		if task.Status == "Paused" {
+			continue
+		}
 		if task.Status != "Downloading" {
 			break
 		}
@@ -688,7 +1170,8 @@ func (d *Downloader) monitorProgress(task *DownloadTask) {
 		task.mu.Unlock()
 
 		// Calculate speed
-		speed := float64(currentDownloaded-lastDownloaded) * 2 / (1024 * 1024) // MB/s
+		task.Speed = float64(currentDownloaded-lastDownloaded) * 2 // bytes/s
+		speed := task.Speed / (1024 * 1024)                        // MB/s
 		lastDownloaded = currentDownloaded
 
 		// Update progress
@@ -703,19 +1186,45 @@ func (d *Downloader) monitorProgress(task *DownloadTask) {
 				// Update status display
 				task.updateStatusDisplay()
 			})
+		} else if task.stream != nil {
+			// Stream size is unknown up front, count finished segments
+			done := 0
+			for _, chunk := range task.Chunks {
+				if chunk.Status == "Completed" {
+					done++
+				}
+			}
+			progress := float64(done) / float64(len(task.Chunks))
+			fyne.Do(func() {
+				task.progressBar.SetValue(progress)
+				downloadedMB := float64(currentDownloaded) / (1024 * 1024)
+				task.speedLabel.SetText(fmt.Sprintf("%.1f MB | %.2f MB/s", downloadedMB, speed))
+				task.updateStatusDisplay()
+			})
 		}
 	}
 }
 
 func (d *Downloader) removeTask(task *DownloadTask) {
 	// Cancel if still downloading
-	if task.Status == "Downloading" || task.Status == "Preparing..." {
+	switch task.Status {
+	case "Downloading", "Paused", "Preparing...", "Fetching metadata", "Seeding", "Crawling", "Queued", "Watching":
 		task.Status = "Cancelled"
 		if task.cancelFunc != nil {
 			task.cancelFunc()
 		}
 	}
 
+	// A mirror takes its files with it
+	task.mu.Lock()
+	children := task.children
+	task.mu.Unlock()
+	for _, child := range children {
+		d.removeTask(child)
+	}
+
+	d.scheduler.takePaused(task)
+
 	// Remove from tasks map
 	d.mu.Lock()
 	delete(d.tasks, task.ID)
@@ -723,6 +1232,9 @@ func (d *Downloader) removeTask(task *DownloadTask) {
 
 	// Remove from UI
 	fyne.Do(func() {
+		if task.parent != nil && task.parent.childList != nil {
+			task.parent.childList.Remove(task.container)
+		}
 		d.taskList.Remove(task.container)
 		d.taskList.Refresh()
 		d.taskContainer.Refresh()
@@ -735,7 +1247,7 @@ func (d *Downloader) clearCompleted() {
 	d.mu.Lock()
 	toRemove := []*DownloadTask{}
 	for _, task := range d.tasks {
-		if task.Status == "Completed" || task.Status == "Cancelled" || task.Status == "Failed" {
+		if task.Status == "Completed" || task.Status == "Up to date" || task.Status == "Cancelled" || task.Status == "Failed" {
 			toRemove = append(toRemove, task)
 		}
 	}
@@ -755,9 +1267,9 @@ func (d *Downloader) updateStats() {
 	d.mu.Lock()
 	for _, task := range d.tasks {
 		switch task.Status {
-		case "Downloading", "Preparing...":
+		case "Downloading", "Preparing...", "Crawling", "Watching":
 			active++
-		case "Completed":
+		case "Completed", "Up to date":
 			completed++
 		case "Failed":
 			failed++
@@ -772,6 +1284,8 @@ func (d *Downloader) updateStats() {
 }
 
 func (d *Downloader) showSettings() {
+	cfg := d.config()
+
 	// Create settings dialog
 	outputEntry := widget.NewEntry()
 	outputEntry.SetText(d.outputFolder)
@@ -787,6 +1301,42 @@ func (d *Downloader) showSettings() {
 
 	outputRow := container.NewBorder(nil, nil, nil, browseBtn, outputEntry)
 
+	// Folder other tools drop URL lists, metalinks and torrents into
+	inboxEntry := widget.NewEntry()
+	inboxEntry.SetText(cfg.Inbox)
+	inboxEntry.SetPlaceHolder("Off")
+
+	inboxBtn := widget.NewButton("Browse...", func() {
+		dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err == nil && uri != nil {
+				inboxEntry.SetText(uri.Path())
+			}
+		}, d.window)
+	})
+
+	inboxRow := container.NewBorder(nil, nil, nil, inboxBtn, inboxEntry)
+
+	// SSH key for sftp:// downloads
+	sshKeyEntry := widget.NewEntry()
+	sshKeyEntry.SetText(cfg.SSHKeyFile)
+	sshKeyEntry.SetPlaceHolder("Agent and ~/.ssh keys are always tried")
+
+	sshKeyBtn := widget.NewButton("Browse...", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err == nil && reader != nil {
+				sshKeyEntry.SetText(reader.URI().Path())
+				reader.Close()
+			}
+		}, d.window)
+	})
+
+	sshKeyRow := container.NewBorder(nil, nil, nil, sshKeyBtn, sshKeyEntry)
+
+	// Seed ratio for finished torrents
+	seedEntry := widget.NewEntry()
+	seedEntry.SetText(strconv.FormatFloat(cfg.SeedRatio, 'f', -1, 64))
+	seedEntry.SetPlaceHolder("0 stops seeding right away")
+
 	// Chunk count slider
 	chunkSlider := widget.NewSlider(1, 50)
 	chunkSlider.Value = float64(d.chunkCount)
@@ -798,10 +1348,28 @@ func (d *Downloader) showSettings() {
 		chunkLabel.SetText(fmt.Sprintf("Number of chunks: %d", int(value)))
 	}
 
+	// S3-compatible storage
+	s3EndpointEntry := widget.NewEntry()
+	s3EndpointEntry.SetText(cfg.S3.Endpoint)
+	s3EndpointEntry.SetPlaceHolder("AWS when empty, e.g. http://minio.lab:9000")
+	s3RegionEntry := widget.NewEntry()
+	s3RegionEntry.SetText(cfg.S3.Region)
+	s3RegionEntry.SetPlaceHolder("us-east-1")
+	s3AccessEntry := widget.NewEntry()
+	s3AccessEntry.SetText(cfg.S3.AccessKey)
+	s3AccessEntry.SetPlaceHolder("AWS_ACCESS_KEY_ID when empty")
+	s3SecretEntry := widget.NewPasswordEntry()
+	s3SecretEntry.SetText(cfg.S3.SecretKey)
+
+	s3Form := widget.NewForm(
+		widget.NewFormItem("Endpoint", s3EndpointEntry),
+		widget.NewFormItem("Region", s3RegionEntry),
+		widget.NewFormItem("Access Key", s3AccessEntry),
+		widget.NewFormItem("Secret Key", s3SecretEntry),
+	)
+
 	// Create form
-	content := container.NewVBox(
-		widget.NewLabelWithStyle("Settings", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
-		widget.NewSeparator(),
+	general := container.NewVBox(
 		container.NewVBox(
 			widget.NewLabel("Download Folder:"),
 			outputRow,
@@ -812,7 +1380,149 @@ func (d *Downloader) showSettings() {
 			chunkSlider,
 		),
 		widget.NewSeparator(),
-		widget.NewLabel("Note: Changes apply to new downloads only"),
+		container.NewVBox(
+			widget.NewLabel("Watch Folder (.txt lists, metalinks, torrents):"),
+			inboxRow,
+		),
+	)
+
+	sourcesTab := container.NewVBox(
+		container.NewVBox(
+			widget.NewLabel("SSH Key (SFTP):"),
+			sshKeyRow,
+		),
+		widget.NewSeparator(),
+		widget.NewLabel("S3 Storage:"),
+		s3Form,
+		widget.NewSeparator(),
+		widget.NewForm(widget.NewFormItem("Torrent Seed Ratio", seedEntry)),
+	)
+
+	// Download windows
+	schedule := d.scheduler.current()
+	scheduleCheck := widget.NewCheck("Only download inside these windows", nil)
+	scheduleCheck.SetChecked(schedule.Enabled)
+	windowsEntry := widget.NewMultiLineEntry()
+	windowsEntry.SetText(formatScheduleWindows(schedule.Windows))
+	windowsEntry.SetPlaceHolder("Mon-Fri 22:00-06:00\nSat,Sun 00:00-24:00")
+	windowsEntry.SetMinRowsVisible(4)
+	insideEntry := widget.NewEntry()
+	insideEntry.SetText(strconv.FormatInt(schedule.LimitInside, 10))
+	outsideEntry := widget.NewEntry()
+	outsideEntry.SetText(strconv.FormatInt(schedule.LimitOutside, 10))
+	overallEntry := widget.NewEntry()
+	overallEntry.SetText(strconv.FormatInt(cfg.SpeedLimit, 10))
+
+	// aria2-compatible remote control
+	rpcCheck := widget.NewCheck("Enable aria2 JSON-RPC server", nil)
+	rpcCheck.SetChecked(cfg.RPC.Enabled)
+	rpcPortEntry := widget.NewEntry()
+	rpcPortEntry.SetText(strconv.Itoa(cfg.RPC.Port))
+	restCheck := widget.NewCheck("Enable REST API and event stream", nil)
+	restCheck.SetChecked(cfg.RPC.REST)
+	rpcSecretEntry := widget.NewPasswordEntry()
+	rpcSecretEntry.SetText(cfg.RPC.Secret)
+	rpcSecretEntry.SetPlaceHolder("Required for browser extensions")
+
+	// Browser interface for the LAN
+	webCheck := widget.NewCheck("Enable web interface", nil)
+	webCheck.SetChecked(cfg.Web.Enabled)
+	webPortEntry := widget.NewEntry()
+	webPortEntry.SetText(strconv.Itoa(cfg.Web.Port))
+	webPasswordEntry := widget.NewPasswordEntry()
+	webPasswordEntry.SetText(cfg.Web.Password)
+
+	// Lets browser extensions hand over downloads
+	extensionIDsEntry := widget.NewEntry()
+	extensionIDsEntry.SetText(d.app.Preferences().String("nativeExtensionIDs"))
+	extensionIDsEntry.SetPlaceHolder("Comma separated Chrome or Firefox IDs")
+	nativeHostBtn := widget.NewButton("Register", func() {
+		d.app.Preferences().SetString("nativeExtensionIDs", extensionIDsEntry.Text)
+		paths, err := installNativeHost(strings.Split(extensionIDsEntry.Text, ","))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("Failed to register native host: %v", err), d.window)
+			return
+		}
+		if len(paths) == 0 {
+			dialog.ShowInformation("Native Host", "No supported browser found", d.window)
+			return
+		}
+		dialog.ShowInformation("Native Host", "Registered:\n"+strings.Join(paths, "\n"), d.window)
+	})
+
+	remoteTab := container.NewVBox(
+		rpcCheck,
+		restCheck,
+		widget.NewForm(
+			widget.NewFormItem("Port", rpcPortEntry),
+			widget.NewFormItem("Secret Token", rpcSecretEntry),
+		),
+		widget.NewLabel("Listens on 127.0.0.1: JSON-RPC at /jsonrpc, REST at /api."),
+		widget.NewSeparator(),
+		webCheck,
+		widget.NewForm(
+			widget.NewFormItem("Port", webPortEntry),
+			widget.NewFormItem("Password", webPasswordEntry),
+		),
+		widget.NewLabel("Reachable from the network; always asks for the password.\n"+
+			"Served over plain HTTP, so the password is sent unencrypted: use it on trusted networks only."),
+		widget.NewSeparator(),
+		widget.NewLabel("Browser extension IDs (native messaging):"),
+		container.NewBorder(nil, nil, nil, nativeHostBtn, extensionIDsEntry),
+	)
+
+	// Copied download links
+	clipboardCheck := widget.NewCheck("Watch the clipboard for download links", nil)
+	clipboardCheck.SetChecked(cfg.Clipboard.Enabled)
+	clipboardMode := widget.NewRadioGroup([]string{"Fill in the URL field", "Ask in a banner"}, nil)
+	clipboardMode.SetSelected("Fill in the URL field")
+	if cfg.Clipboard.Prompt {
+		clipboardMode.SetSelected("Ask in a banner")
+	}
+	clipboardPatterns := widget.NewMultiLineEntry()
+	clipboardPatterns.SetText(cfg.Clipboard.Patterns)
+	clipboardPatterns.SetMinRowsVisible(6)
+
+	clipboardTab := container.NewVBox(
+		clipboardCheck,
+		clipboardMode,
+		widget.NewLabel("Offer links matching (an extension like .iso or a regular expression per line):"),
+		clipboardPatterns,
+	)
+
+	rulesTab, editedRules := d.createRulesTab()
+
+	scheduleTab := container.NewVBox(
+		scheduleCheck,
+		widget.NewLabel("One window per line: days and a time range"),
+		windowsEntry,
+		widget.NewForm(
+			widget.NewFormItem("Limit inside (KB/s)", insideEntry),
+			widget.NewFormItem("Limit outside (KB/s)", outsideEntry),
+			widget.NewFormItem("Overall limit (KB/s)", overallEntry),
+		),
+		widget.NewLabel("A window limit of 0 uses the overall limit; an overall limit of 0 means unlimited.\n"+
+			"Outside windows new downloads wait and active ones pause."),
+	)
+
+	content := container.NewBorder(
+		container.NewVBox(
+			widget.NewLabelWithStyle("Settings", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
+			widget.NewSeparator(),
+		),
+		container.NewVBox(
+			widget.NewSeparator(),
+			widget.NewLabel("Note: Changes apply to new downloads only"),
+		),
+		nil, nil,
+		container.NewAppTabs(
+			container.NewTabItem("General", general),
+			container.NewTabItem("Sources", sourcesTab),
+			container.NewTabItem("Rules", rulesTab),
+			container.NewTabItem("Schedule", scheduleTab),
+			container.NewTabItem("Clipboard", clipboardTab),
+			container.NewTabItem("Remote", remoteTab),
+		),
 	)
 
 	// Create custom dialog
@@ -820,11 +1530,84 @@ func (d *Downloader) showSettings() {
 		if save {
 			d.outputFolder = outputEntry.Text
 			d.chunkCount = int(chunkSlider.Value)
+			setRules(editedRules())
+
+			windows, err := parseScheduleWindows(windowsEntry.Text)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("Schedule not saved: %v", err), d.window)
+			} else {
+				inside, _ := strconv.ParseInt(strings.TrimSpace(insideEntry.Text), 10, 64)
+				outside, _ := strconv.ParseInt(strings.TrimSpace(outsideEntry.Text), 10, 64)
+				d.scheduler.configure(scheduleSettings{
+					Enabled:      scheduleCheck.Checked && len(windows) > 0,
+					Windows:      windows,
+					LimitInside:  max(inside, 0),
+					LimitOutside: max(outside, 0),
+				})
+			}
+
+			cfg.Inbox = strings.TrimSpace(inboxEntry.Text)
+			cfg.SSHKeyFile = sshKeyEntry.Text
+			cfg.S3 = s3Settings{
+				Endpoint:  s3EndpointEntry.Text,
+				Region:    s3RegionEntry.Text,
+				AccessKey: s3AccessEntry.Text,
+				SecretKey: s3SecretEntry.Text,
+			}
+			if ratio, err := strconv.ParseFloat(seedEntry.Text, 64); err == nil && ratio >= 0 {
+				cfg.SeedRatio = ratio
+			}
+			if limit, err := strconv.ParseInt(strings.TrimSpace(overallEntry.Text), 10, 64); err == nil && limit >= 0 {
+				cfg.SpeedLimit = limit
+			}
+
+			matcher, err := parseClipboardPatterns(clipboardPatterns.Text)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("Clipboard patterns not saved: %v", err), d.window)
+			} else {
+				cfg.Clipboard = clipboardSettings{
+					Enabled:  clipboardCheck.Checked,
+					Prompt:   clipboardMode.Selected == "Ask in a banner",
+					Patterns: clipboardPatterns.Text,
+				}
+			}
+
+			port, err := strconv.Atoi(strings.TrimSpace(rpcPortEntry.Text))
+			if err != nil || port < 1 || port > 65535 {
+				port = cfg.RPC.Port
+			}
+			cfg.RPC = rpcSettings{
+				Enabled: rpcCheck.Checked,
+				REST:    restCheck.Checked,
+				Port:    port,
+				Secret:  rpcSecretEntry.Text,
+			}
+
+			webPort, err := strconv.Atoi(strings.TrimSpace(webPortEntry.Text))
+			if err != nil || webPort < 1 || webPort > 65535 {
+				webPort = cfg.Web.Port
+			}
+			cfg.Web = webSettings{
+				Enabled:  webCheck.Checked,
+				Port:     webPort,
+				Password: webPasswordEntry.Text,
+			}
+
+			d.setConfig(func(s *appSettings) { *s = cfg })
+			go func() {
+				d.scheduleTick()
+				d.applySpeedLimit()
+			}()
+			if matcher != nil {
+				d.clipboard.setPatterns(matcher)
+			}
+			go d.startRPC()
+			go d.startWebUI()
 			d.saveSettings()
 		}
 	}, d.window)
 
-	settingsDialog.Resize(fyne.NewSize(500, 300))
+	settingsDialog.Resize(fyne.NewSize(550, 420))
 	settingsDialog.Show()
 }
 
@@ -905,8 +1688,38 @@ func (m *myTheme) Size(name fyne.ThemeSizeName) float32 {
 
 func (d *Downloader) saveSettings() {
 	prefs := d.app.Preferences()
+	cfg := d.config()
 	prefs.SetString("outputFolder", d.outputFolder)
 	prefs.SetInt("chunkCount", d.chunkCount)
+	prefs.SetString("watchFolder", cfg.Inbox)
+	prefs.SetString("sshKeyFile", cfg.SSHKeyFile)
+	prefs.SetString("s3Endpoint", cfg.S3.Endpoint)
+	prefs.SetString("s3Region", cfg.S3.Region)
+	prefs.SetString("s3AccessKey", cfg.S3.AccessKey)
+	prefs.SetString("s3SecretKey", cfg.S3.SecretKey)
+	prefs.SetFloat("seedRatio", cfg.SeedRatio)
+	prefs.SetInt("speedLimit", int(cfg.SpeedLimit))
+
+	schedule := d.scheduler.current()
+	prefs.SetBool("scheduleEnabled", schedule.Enabled)
+	prefs.SetString("scheduleWindows", formatScheduleWindows(schedule.Windows))
+	prefs.SetInt("scheduleLimitInside", int(schedule.LimitInside))
+	prefs.SetInt("scheduleLimitOutside", int(schedule.LimitOutside))
+
+	prefs.SetBool("rpcEnabled", cfg.RPC.Enabled)
+	prefs.SetBool("restEnabled", cfg.RPC.REST)
+	prefs.SetInt("rpcPort", cfg.RPC.Port)
+	prefs.SetString("rpcSecret", cfg.RPC.Secret)
+
+	prefs.SetBool("clipboardEnabled", cfg.Clipboard.Enabled)
+	prefs.SetBool("clipboardPrompt", cfg.Clipboard.Prompt)
+	prefs.SetString("clipboardPatterns", cfg.Clipboard.Patterns)
+
+	prefs.SetBool("webEnabled", cfg.Web.Enabled)
+	prefs.SetInt("webPort", cfg.Web.Port)
+	prefs.SetString("webPassword", cfg.Web.Password)
+
+	d.saveRules()
 }
 
 func (d *Downloader) loadSettings() {
@@ -919,9 +1732,101 @@ func (d *Downloader) loadSettings() {
 	if chunks := prefs.Int("chunkCount"); chunks > 0 {
 		d.chunkCount = chunks
 	}
+
+	cfg := defaultSettings()
+	cfg.Inbox = prefs.String("watchFolder")
+	cfg.SSHKeyFile = prefs.String("sshKeyFile")
+	cfg.S3 = s3Settings{
+		Endpoint:  prefs.String("s3Endpoint"),
+		Region:    prefs.String("s3Region"),
+		AccessKey: prefs.String("s3AccessKey"),
+		SecretKey: prefs.String("s3SecretKey"),
+	}
+	cfg.SeedRatio = prefs.FloatWithFallback("seedRatio", cfg.SeedRatio)
+	cfg.SpeedLimit = int64(max(prefs.Int("speedLimit"), 0))
+
+	windows, _ := parseScheduleWindows(prefs.String("scheduleWindows"))
+	d.scheduler.configure(scheduleSettings{
+		Enabled:      prefs.Bool("scheduleEnabled") && len(windows) > 0,
+		Windows:      windows,
+		LimitInside:  int64(prefs.Int("scheduleLimitInside")),
+		LimitOutside: int64(prefs.Int("scheduleLimitOutside")),
+	})
+
+	cfg.RPC = rpcSettings{
+		Enabled: prefs.Bool("rpcEnabled"),
+		REST:    prefs.Bool("restEnabled"),
+		Port:    prefs.IntWithFallback("rpcPort", cfg.RPC.Port),
+		Secret:  prefs.String("rpcSecret"),
+	}
+	cfg.Clipboard = clipboardSettings{
+		Enabled:  prefs.Bool("clipboardEnabled"),
+		Prompt:   prefs.Bool("clipboardPrompt"),
+		Patterns: prefs.StringWithFallback("clipboardPatterns", cfg.Clipboard.Patterns),
+	}
+	if matcher, err := parseClipboardPatterns(cfg.Clipboard.Patterns); err == nil {
+		d.clipboard.setPatterns(matcher)
+	}
+
+	cfg.Web = webSettings{
+		Enabled:  prefs.Bool("webEnabled"),
+		Port:     prefs.IntWithFallback("webPort", cfg.Web.Port),
+		Password: prefs.String("webPassword"),
+	}
+	d.setConfig(func(s *appSettings) { *s = cfg })
+
+	d.loadRules()
 }
 
 func main() {
+	args := os.Args[1:]
+
+	// Browsers start us as their native messaging host
+	if isNativeHostLaunch(args) {
+		os.Exit(runNativeHost(os.Stdin, os.Stdout))
+	}
+	if len(args) > 0 && args[0] == "--install-native-host" {
+		paths, err := installNativeHost(args[1:])
+		for _, p := range paths {
+			fmt.Println(p)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+		fmt.Printf(commandLineUsage, filepath.Base(os.Args[0]))
+		return
+	}
+	req, err := parseCommandLine(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintf(os.Stderr, commandLineUsage, filepath.Base(os.Args[0]))
+		os.Exit(2)
+	}
+
+	// A second launch hands its URLs to the first and exits
+	ln, handedOver, err := claimInstance(req)
+	switch {
+	case handedOver && err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	case handedOver:
+		return
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "Running without single-instance lock:", err)
+	}
+
 	downloader := NewDownloader()
+	if ln != nil {
+		defer ln.Close()
+		go downloader.serveHandoffs(ln)
+	}
+	if len(req.URLs) > 0 {
+		go downloader.acceptHandoff(req)
+	}
 	downloader.window.ShowAndRun()
 }
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// Metalink documents are small; anything bigger is not what we asked for.
+const maxMetalinkSize = 10 * 1024 * 1024
+
+// How many times a corrupted piece is refetched before its chunk fails.
+const maxPieceRetries = 3
+
+// Metalink v4 (RFC 5854). Tags carry no namespace so the decoder accepts
+// documents regardless of prefix. Version 3 files sit under <files> and are
+// converted to v4 entries by parseMetalink.
+type metalinkDoc struct {
+	XMLName xml.Name        `xml:"metalink"`
+	Files   []metalinkFile  `xml:"file"`
+	V3Files []metalink3File `xml:"files>file"`
+}
+
+type metalinkFile struct {
+	Name   string          `xml:"name,attr"`
+	Size   int64           `xml:"size"`
+	Hashes []metalinkHash  `xml:"hash"`
+	Pieces *metalinkPieces `xml:"pieces"`
+	URLs   []metalinkURL   `xml:"url"`
+}
+
+type metalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type metalinkPieces struct {
+	Length int64    `xml:"length,attr"`
+	Type   string   `xml:"type,attr"`
+	Hashes []string `xml:"hash"`
+}
+
+type metalinkURL struct {
+	Priority int    `xml:"priority,attr"`
+	Location string `xml:"location,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// metalink3File is a file entry in the older metalinker.org format, which
+// nests hashes and URLs and ranks mirrors by preference, highest first.
+type metalink3File struct {
+	Name   string           `xml:"name,attr"`
+	Size   int64            `xml:"size"`
+	Hashes []metalinkHash   `xml:"verification>hash"`
+	Pieces *metalink3Pieces `xml:"verification>pieces"`
+	URLs   []metalink3URL   `xml:"resources>url"`
+}
+
+type metalink3Pieces struct {
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+	Hashes []struct {
+		Piece int    `xml:"piece,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"hash"`
+}
+
+type metalink3URL struct {
+	Type       string `xml:"type,attr"`
+	Preference int    `xml:"preference,attr"`
+	Location   string `xml:"location,attr"`
+	Value      string `xml:",chardata"`
+}
+
+// v4 turns a version 3 entry into its version 4 equivalent.
+func (f metalink3File) v4() metalinkFile {
+	file := metalinkFile{Name: f.Name, Size: f.Size, Hashes: f.Hashes}
+	if p := f.Pieces; p != nil {
+		hashes := p.Hashes
+		sort.SliceStable(hashes, func(i, j int) bool { return hashes[i].Piece < hashes[j].Piece })
+		file.Pieces = &metalinkPieces{Length: p.Length, Type: p.Type}
+		for _, h := range hashes {
+			file.Pieces.Hashes = append(file.Pieces.Hashes, h.Value)
+		}
+	}
+	for _, u := range f.URLs {
+		// Links of type bittorrent point at a .torrent, not the file
+		if t := strings.ToLower(u.Type); t != "" && t != "http" && t != "https" {
+			continue
+		}
+		// Preferences run 1-100, priorities the other way from 1
+		priority := 0
+		if u.Preference > 0 {
+			priority = max(101-u.Preference, 1)
+		}
+		file.URLs = append(file.URLs, metalinkURL{Priority: priority, Location: u.Location, Value: u.Value})
+	}
+	return file
+}
+
+func isMetalinkURL(urlStr string) bool {
+	p := urlStr
+	if u, err := url.Parse(urlStr); err == nil && u.Path != "" {
+		p = u.Path
+	}
+	p = strings.ToLower(p)
+	return strings.HasSuffix(p, ".meta4") || strings.HasSuffix(p, ".metalink")
+}
+
+func parseMetalink(data []byte) (*metalinkDoc, error) {
+	var doc metalinkDoc
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid metalink: %v", err)
+	}
+	for _, f := range doc.V3Files {
+		doc.Files = append(doc.Files, f.v4())
+	}
+	if len(doc.Files) == 0 {
+		return nil, fmt.Errorf("metalink lists no files")
+	}
+	for _, f := range doc.Files {
+		if f.Name == "" {
+			return nil, fmt.Errorf("metalink file entry has no name")
+		}
+		if len(f.URLs) == 0 {
+			return nil, fmt.Errorf("metalink lists no URLs for %s", f.Name)
+		}
+	}
+	return &doc, nil
+}
+
+// fetchMetalink reads a metalink document from an HTTP(S) URL or a local path.
+func fetchMetalink(urlStr string) ([]byte, error) {
+	if !strings.HasPrefix(urlStr, "http://") && !strings.HasPrefix(urlStr, "https://") {
+		name := urlStr
+		if u, err := url.Parse(urlStr); err == nil && u.Scheme == "file" {
+			name = localPath(u)
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return io.ReadAll(io.LimitReader(file, maxMetalinkSize))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	req, err := http.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("Accept", "application/metalink4+xml, application/metalink+xml;q=0.9, application/xml;q=0.8, */*;q=0.7")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMetalinkSize))
+}
+
+// queueMetalink fetches a metalink document and queues one task per file.
+// Runs in the background since it touches the network.
+func (d *Downloader) queueMetalink(urlStr string) {
+	data, err := fetchMetalink(urlStr)
+	var doc *metalinkDoc
+	if err == nil {
+		doc, err = parseMetalink(data)
+	}
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("Failed to load metalink: %v", err), d.window)
+		})
+		return
+	}
+
+	var tasks []*DownloadTask
+	for _, f := range doc.Files {
+		task, err := d.metalinkTask(f)
+		if err != nil {
+			fyne.Do(func() {
+				dialog.ShowError(err, d.window)
+			})
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+
+	fyne.Do(func() {
+		for _, task := range tasks {
+			d.addTask(task)
+		}
+	})
+}
+
+func (d *Downloader) metalinkTask(f metalinkFile) (*DownloadTask, error) {
+	name, err := safeRelativePath(f.Name)
+	if err != nil {
+		return nil, fmt.Errorf("metalink file %q: %v", f.Name, err)
+	}
+
+	// Lower priority values are preferred; missing priorities go last
+	sorted := append([]metalinkURL(nil), f.URLs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		pi, pj := sorted[i].Priority, sorted[j].Priority
+		if pi == 0 {
+			pi = 1 << 30
+		}
+		if pj == 0 {
+			pj = 1 << 30
+		}
+		return pi < pj
+	})
+
+	var mirrors []string
+	for _, u := range sorted {
+		value := strings.TrimSpace(u.Value)
+		if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+			mirrors = append(mirrors, value)
+		}
+	}
+	if len(mirrors) == 0 {
+		return nil, fmt.Errorf("metalink file %q has no usable mirrors", f.Name)
+	}
+
+	task := d.newUserTask(mirrors[0])
+	task.Mirrors = mirrors
+	task.OutputFile = filepath.Join(d.taskFolder(task), filepath.FromSlash(name))
+
+	if f.Size > 0 {
+		task.TotalSize = f.Size
+		task.infoKnown = true
+	}
+
+	for _, h := range f.Hashes {
+		if newHash(h.Type) == nil {
+			continue
+		}
+		if task.ExpectedHashes == nil {
+			task.ExpectedHashes = make(map[string]string)
+		}
+		task.ExpectedHashes[normalizeHashType(h.Type)] = strings.ToLower(strings.TrimSpace(h.Value))
+	}
+
+	// Piece hashes are only usable when they cover the whole known size
+	if p := f.Pieces; p != nil && p.Length > 0 && f.Size > 0 && newHash(p.Type) != nil {
+		if int64(len(p.Hashes)) == (f.Size+p.Length-1)/p.Length {
+			task.PieceLength = p.Length
+			task.PieceHashType = normalizeHashType(p.Type)
+			task.PieceHashes = make([]string, len(p.Hashes))
+			for i, h := range p.Hashes {
+				task.PieceHashes[i] = strings.ToLower(strings.TrimSpace(h))
+			}
+		}
+	}
+
+	return task, nil
+}
+
+// safeRelativePath rejects names that would escape the output folder.
+func safeRelativePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) {
+		return "", fmt.Errorf("absolute paths are not allowed")
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("path escapes the download folder")
+	}
+	return cleaned, nil
+}
+
+// normalizeHashType maps spellings like "SHA256" to the metalink names.
+func normalizeHashType(hashType string) string {
+	switch strings.ToLower(strings.TrimSpace(hashType)) {
+	case "md5":
+		return "md5"
+	case "sha-1", "sha1":
+		return "sha-1"
+	case "sha-256", "sha256":
+		return "sha-256"
+	case "sha-512", "sha512":
+		return "sha-512"
+	}
+	return ""
+}
+
+func newHash(hashType string) hash.Hash {
+	switch normalizeHashType(hashType) {
+	case "md5":
+		return md5.New()
+	case "sha-1":
+		return sha1.New()
+	case "sha-256":
+		return sha256.New()
+	case "sha-512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// initializePieceChunks lays chunks out on piece boundaries so each piece
+// can be verified from a single part file.
+func (d *Downloader) initializePieceChunks(task *DownloadTask) {
+	pieceCount := int64(len(task.PieceHashes))
+	chunkCount := int64(task.ChunkCount)
+	if chunkCount < 1 {
+		chunkCount = 1
+	}
+	if chunkCount > pieceCount {
+		chunkCount = pieceCount
+	}
+	piecesPerChunk := (pieceCount + chunkCount - 1) / chunkCount
+	chunkCount = (pieceCount + piecesPerChunk - 1) / piecesPerChunk
+
+	task.ChunkCount = int(chunkCount)
+	task.Chunks = make([]ChunkInfo, task.ChunkCount)
+	for i := int64(0); i < chunkCount; i++ {
+		start := i * piecesPerChunk * task.PieceLength
+		end := start + piecesPerChunk*task.PieceLength - 1
+		if end >= task.TotalSize {
+			end = task.TotalSize - 1
+		}
+
+		task.Chunks[i] = ChunkInfo{
+			Index:  int(i),
+			Start:  start,
+			End:    end,
+			Status: "Pending",
+		}
+	}
+}
+
+// verifyChunkPieces hashes every piece in a finished chunk and refetches
+// corrupted ones from other mirrors. Returns false if a piece stays bad.
+func (d *Downloader) verifyChunkPieces(task *DownloadTask, chunk *ChunkInfo) bool {
+	tempFile := fmt.Sprintf("%s.part%d", task.OutputFile, chunk.Index)
+	file, err := os.OpenFile(tempFile, os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return checkPieces(task, file, chunk.Start, chunk.End, chunk.Index)
+}
+
+// verifyFilePieces checks every piece of the finished output file.
+func (d *Downloader) verifyFilePieces(task *DownloadTask) bool {
+	file, err := os.OpenFile(task.OutputFile, os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return checkPieces(task, file, 0, task.TotalSize-1, 0)
+}
+
+// checkPieces verifies the pieces covering bytes start-end, which file
+// holds from its own offset 0, refetching bad ones. attempt0 picks the
+// first mirror to retry from.
+func checkPieces(task *DownloadTask, file *os.File, start, end int64, attempt0 int) bool {
+	mirrors := task.Mirrors
+	if len(mirrors) == 0 {
+		mirrors = []string{task.URL}
+	}
+
+	for piece := start / task.PieceLength; piece <= end/task.PieceLength; piece++ {
+		pieceStart := piece * task.PieceLength
+		pieceEnd := pieceStart + task.PieceLength - 1
+		if pieceEnd >= task.TotalSize {
+			pieceEnd = task.TotalSize - 1
+		}
+		offset := pieceStart - start
+		length := pieceEnd - pieceStart + 1
+
+		ok := pieceMatches(file, offset, length, task.PieceHashType, task.PieceHashes[piece])
+		for attempt := 0; !ok && attempt < maxPieceRetries; attempt++ {
+			// Start with the next mirror, the current one just served bad data
+			mirror := mirrors[(attempt0+attempt+1)%len(mirrors)]
+			if err := fetchRangeAt(task, mirror, file, offset, pieceStart, pieceEnd); err != nil {
+				continue
+			}
+			ok = pieceMatches(file, offset, length, task.PieceHashType, task.PieceHashes[piece])
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func pieceMatches(file *os.File, offset, length int64, hashType, expected string) bool {
+	h := newHash(hashType)
+	if h == nil {
+		return false
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(file, offset, length)); err != nil {
+		return false
+	}
+	return hex.EncodeToString(h.Sum(nil)) == expected
+}
+
+// fetchRangeAt downloads bytes start-end of urlStr, a mirror of task, and
+// writes them to file at offset.
+func fetchRangeAt(task *DownloadTask, urlStr string, file *os.File, offset, start, end int64) error {
+	req, err := http.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	setHeaders(req, task.Headers)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	if task.Proxy != "" {
+		transport := &http.Transport{}
+		if err := setProxy(transport, task.Proxy); err != nil {
+			return err
+		}
+		client.Transport = transport
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("range request returned %s", resp.Status)
+	}
+
+	data := make([]byte, end-start+1)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, offset)
+	return err
+}
+
+// verifyExpectedHashes checks the finished file against the strongest
+// whole-file hash the task was given.
+func (d *Downloader) verifyExpectedHashes(task *DownloadTask) error {
+	for _, hashType := range []string{"sha-512", "sha-256", "sha-1", "md5"} {
+		expected, ok := task.ExpectedHashes[hashType]
+		if !ok {
+			continue
+		}
+
+		var actual string
+		switch hashType {
+		case "sha-256":
+			actual = task.SHA256Hash
+		case "md5":
+			actual = task.MD5Hash
+		default:
+			file, err := os.Open(task.OutputFile)
+			if err != nil {
+				return err
+			}
+			h := newHash(hashType)
+			_, err = io.Copy(h, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+			actual = hex.EncodeToString(h.Sum(nil))
+		}
+
+		if actual != expected {
+			return fmt.Errorf("Checksum mismatch (%s)", hashType)
+		}
+		return nil
+	}
+	return nil
+}
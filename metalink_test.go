@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckPiecesRefetchesThroughTaskProxy(t *testing.T) {
+	const pieceLength = 1024
+	data := make([]byte, 4*pieceLength)
+	rand.Read(data)
+	var hashes []string
+	for off := 0; off < len(data); off += pieceLength {
+		sum := sha256.Sum256(data[off : off+pieceLength])
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+	}
+
+	// The mirror's host does not resolve; only the proxy reaches it, and
+	// only with the task's cookie
+	var proxied int
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "mirror.invalid" || r.Header.Get("Cookie") != "session=abc" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		proxied++
+		spec := strings.TrimPrefix(r.Header.Get("Range"), "bytes=")
+		first, last, _ := strings.Cut(spec, "-")
+		start, _ := strconv.Atoi(first)
+		end, _ := strconv.Atoi(last)
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[start : end+1])
+	}))
+	defer proxy.Close()
+
+	path := filepath.Join(t.TempDir(), "file.bin")
+	corrupt := bytes.Clone(data)
+	copy(corrupt[2*pieceLength:], make([]byte, 100))
+	if err := os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	task := &DownloadTask{
+		URL:           "http://mirror.invalid/file.bin",
+		TotalSize:     int64(len(data)),
+		PieceLength:   pieceLength,
+		PieceHashType: "sha-256",
+		PieceHashes:   hashes,
+		Headers:       map[string]string{"Cookie": "session=abc"},
+		Proxy:         proxy.URL,
+	}
+	if !checkPieces(task, file, 0, task.TotalSize-1, 0) {
+		t.Fatal("bad piece was not repaired")
+	}
+	if proxied != 1 {
+		t.Errorf("%d pieces fetched, want 1", proxied)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("repaired file differs from the original")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A mirror this many times slower than the fastest one is dropped.
+const mirrorSlowFactor = 4
+
+type mirrorStat struct {
+	bytes    int64
+	elapsed  time.Duration
+	inflight int
+	dropped  bool
+}
+
+func (m *mirrorStat) throughput() float64 {
+	if m.elapsed <= 0 {
+		return 0
+	}
+	return float64(m.bytes) / m.elapsed.Seconds()
+}
+
+// chunkURL returns the URL a chunk should be fetched from.
+func (task *DownloadTask) chunkURL(chunk *ChunkInfo) string {
+	if chunk.Mirror != "" {
+		return chunk.Mirror
+	}
+	return task.URL
+}
+
+// activeMirrors returns the mirrors that haven't been dropped.
+func (task *DownloadTask) activeMirrors() []string {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	var active []string
+	for _, m := range task.Mirrors {
+		if stat := task.mirrorStats[m]; stat == nil || !stat.dropped {
+			active = append(active, m)
+		}
+	}
+	return active
+}
+
+// pickMirror chooses the mirror for the next chunk. Mirrors with no samples
+// yet go first so every mirror gets measured; after that each mirror's
+// observed throughput is shared between the chunks already running on it.
+func (task *DownloadTask) pickMirror() string {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	if task.mirrorStats == nil {
+		task.mirrorStats = make(map[string]*mirrorStat)
+	}
+
+	best := ""
+	bestScore := -1.0
+	for _, m := range task.Mirrors {
+		stat := task.mirrorStats[m]
+		if stat == nil {
+			stat = &mirrorStat{}
+			task.mirrorStats[m] = stat
+		}
+		if stat.dropped {
+			continue
+		}
+
+		var score float64
+		if stat.elapsed == 0 {
+			// Unmeasured mirrors win unless they're already busy
+			score = 1e18 / float64(stat.inflight+1)
+		} else {
+			score = stat.throughput() / float64(stat.inflight+1)
+		}
+		if score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+
+	if best == "" {
+		return task.URL
+	}
+	task.mirrorStats[best].inflight++
+	return best
+}
+
+// recordMirror updates a mirror's throughput after a chunk and drops it if
+// it failed or is far slower than the fastest mirror. The last remaining
+// mirror is never dropped.
+func (task *DownloadTask) recordMirror(mirror string, bytes int64, elapsed time.Duration, failed bool) {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	stat := task.mirrorStats[mirror]
+	if stat == nil {
+		return
+	}
+	stat.inflight--
+	stat.bytes += bytes
+	stat.elapsed += elapsed
+
+	alive := 0
+	fastest := 0.0
+	for _, m := range task.Mirrors {
+		s := task.mirrorStats[m]
+		if s == nil || s.dropped {
+			continue
+		}
+		alive++
+		if t := s.throughput(); t > fastest {
+			fastest = t
+		}
+	}
+	if alive <= 1 {
+		return
+	}
+
+	if failed || (stat.throughput() > 0 && stat.throughput()*mirrorSlowFactor < fastest) {
+		stat.dropped = true
+	}
+}
+
+// downloadChunkFromMirrors downloads a chunk from the best available mirror,
+// moving on to another mirror if it fails.
+func (d *Downloader) downloadChunkFromMirrors(task *DownloadTask, chunk *ChunkInfo) {
+	for attempt := 0; attempt < len(task.Mirrors); attempt++ {
+		chunk.Mirror = task.pickMirror()
+		chunk.Status = "Downloading"
+
+		started := time.Now()
+		d.downloadChunk(task, chunk)
+		failed := chunk.Status != "Completed"
+		task.recordMirror(chunk.Mirror, chunk.Downloaded, time.Since(started), failed)
+
+		if !failed || task.Status == "Cancelled" {
+			return
+		}
+
+		// Discard the partial chunk before retrying elsewhere
+		task.mu.Lock()
+		task.Downloaded -= chunk.Downloaded
+		task.mu.Unlock()
+		chunk.Downloaded = 0
+		chunk.Progress = 0
+	}
+}
+
+// checkMirrors probes every mirror and drops those that disagree with the
+// primary URL on size or strong ETag.
+func (d *Downloader) checkMirrors(task *DownloadTask) error {
+	type probeResult struct {
+		size int64
+		etag string
+		err  error
+	}
+
+	results := make([]probeResult, len(task.Mirrors))
+	var wg sync.WaitGroup
+	for i, m := range task.Mirrors {
+		wg.Add(1)
+		go func(i int, m string) {
+			defer wg.Done()
+			size, etag, err := probeMirror(task, m)
+			results[i] = probeResult{size, etag, err}
+		}(i, m)
+	}
+	wg.Wait()
+
+	expectedETag := ""
+	if !strings.HasPrefix(task.ETag, "W/") {
+		expectedETag = task.ETag
+	}
+
+	var kept []string
+	for i, m := range task.Mirrors {
+		r := results[i]
+		if r.err != nil {
+			continue
+		}
+		if task.TotalSize > 0 && r.size != task.TotalSize {
+			continue
+		}
+		if expectedETag != "" && r.etag != "" && !strings.HasPrefix(r.etag, "W/") && r.etag != expectedETag {
+			continue
+		}
+		kept = append(kept, m)
+	}
+
+	if len(kept) == 0 {
+		return fmt.Errorf("no mirror matches the expected file")
+	}
+	task.Mirrors = kept
+	task.URL = kept[0]
+	return nil
+}
+
+// probeMirror asks a mirror of task for the file's size and ETag and
+// confirms it accepts range requests. It goes the way the download will,
+// with the task's headers and proxy.
+func probeMirror(task *DownloadTask, urlStr string) (int64, string, error) {
+	req, err := http.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	setHeaders(req, task.Headers)
+	req.Header.Set("Range", "bytes=0-0")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	if task.Proxy != "" {
+		transport := &http.Transport{}
+		if err := setProxy(transport, task.Proxy); err != nil {
+			return 0, "", err
+		}
+		client.Transport = transport
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, "", fmt.Errorf("mirror does not support ranges: %s", resp.Status)
+	}
+
+	_, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	if !ok {
+		return 0, "", fmt.Errorf("mirror sent no Content-Range")
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("mirror sent an unknown size")
+	}
+	return size, resp.Header.Get("ETag"), nil
+}
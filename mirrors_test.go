@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestCheckMirrorsUsesTaskHeadersAndProxy(t *testing.T) {
+	// Mirrors on hosts that do not resolve; the proxy serves them to
+	// requests carrying the task's cookie
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "session=abc" || r.Header.Get("Range") != "bytes=0-0" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		size := "1000"
+		if r.URL.Host == "short.invalid" {
+			size = "999"
+		}
+		w.Header().Set("Content-Range", "bytes 0-0/"+size)
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte{0})
+	}))
+	defer proxy.Close()
+
+	task := &DownloadTask{
+		URL:       "http://a.invalid/file.iso",
+		Mirrors:   []string{"http://a.invalid/file.iso", "http://short.invalid/file.iso", "http://b.invalid/file.iso"},
+		TotalSize: 1000,
+		ETag:      `"v1"`,
+		Headers:   map[string]string{"Cookie": "session=abc"},
+		Proxy:     proxy.URL,
+	}
+	d := &Downloader{}
+	if err := d.checkMirrors(task); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http://a.invalid/file.iso", "http://b.invalid/file.iso"}
+	if !slices.Equal(task.Mirrors, want) {
+		t.Errorf("kept %v, want %v", task.Mirrors, want)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Name browsers know the native messaging host by
+const nativeHostName = "com.chunkeddownloader.host"
+
+// Chrome refuses bigger messages from a host; ours are tiny anyway
+const maxNativeMessage = 1 << 20
+
+// nativeMessage is what an extension sends for an intercepted download.
+type nativeMessage struct {
+	Type     string            `json:"type"` // "download" or "ping"
+	URL      string            `json:"url"`
+	URLs     []string          `json:"urls"`
+	Referrer string            `json:"referrer"`
+	Cookies  string            `json:"cookies"`
+	Headers  map[string]string `json:"headers"`
+	FileName string            `json:"filename"`
+	Dir      string            `json:"dir"`
+}
+
+// isNativeHostLaunch reports whether a browser started us as its native
+// messaging host: Chromium passes the extension origin, Firefox the
+// manifest path and the extension ID.
+func isNativeHostLaunch(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if args[0] == "--native-messaging" || strings.HasPrefix(args[0], "chrome-extension://") {
+		return true
+	}
+	return len(args) == 2 && strings.HasSuffix(args[0], ".json")
+}
+
+// runNativeHost relays messages from an extension until the browser closes
+// stdin. Each message is a native-endian length followed by JSON.
+func runNativeHost(in io.Reader, out io.Writer) int {
+	for {
+		var size uint32
+		if err := binary.Read(in, binary.NativeEndian, &size); err != nil {
+			if err == io.EOF {
+				return 0
+			}
+			return 1
+		}
+		if size > maxNativeMessage {
+			return 1
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(in, body); err != nil {
+			return 1
+		}
+
+		reply := handoffReply{OK: true}
+		var msg nativeMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			reply = handoffReply{Error: "invalid message: " + err.Error()}
+		} else if err := handleNativeMessage(msg); err != nil {
+			reply = handoffReply{Error: err.Error()}
+		}
+
+		data, _ := json.Marshal(reply)
+		if err := binary.Write(out, binary.NativeEndian, uint32(len(data))); err != nil {
+			return 1
+		}
+		if _, err := out.Write(data); err != nil {
+			return 1
+		}
+	}
+}
+
+func handleNativeMessage(msg nativeMessage) error {
+	switch msg.Type {
+	case "ping":
+		return nil
+	case "download", "":
+	default:
+		return fmt.Errorf("unknown message type %q", msg.Type)
+	}
+
+	urls := msg.URLs
+	if msg.URL != "" {
+		urls = append([]string{msg.URL}, urls...)
+	}
+	return sendHandoffOrLaunch(handoffRequest{
+		URLs:     urls,
+		Referrer: msg.Referrer,
+		Cookies:  msg.Cookies,
+		Headers:  msg.Headers,
+		FileName: msg.FileName,
+		Dir:      msg.Dir,
+	})
+}
+
+// installNativeHost registers this executable as the native messaging host
+// for the given extensions in every installed browser it knows. Chromium
+// IDs are 32 letters; anything else is taken as a Firefox add-on ID.
+func installNativeHost(extensionIDs []string) ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, err
+	}
+
+	var origins, addons []string
+	for _, id := range extensionIDs {
+		id = strings.TrimSpace(id)
+		switch {
+		case id == "":
+		case isChromiumExtensionID(id):
+			origins = append(origins, "chrome-extension://"+id+"/")
+		default:
+			addons = append(addons, id)
+		}
+	}
+	if len(origins) == 0 && len(addons) == 0 {
+		return nil, fmt.Errorf("no extension IDs given")
+	}
+
+	manifest := map[string]any{
+		"name":        nativeHostName,
+		"description": "Advanced Download Manager",
+		"path":        exe,
+		"type":        "stdio",
+	}
+	chromeDirs, firefoxDirs, err := nativeHostDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	var written []string
+	write := func(dirs []string, key string, ids []string) error {
+		if len(ids) == 0 {
+			return nil
+		}
+		manifest[key] = ids
+		data, _ := json.MarshalIndent(manifest, "", "  ")
+		delete(manifest, key)
+		for _, dir := range dirs {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			path := filepath.Join(dir, nativeHostName+".json")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return err
+			}
+			written = append(written, path)
+		}
+		return nil
+	}
+	if err := write(chromeDirs, "allowed_origins", origins); err != nil {
+		return written, err
+	}
+	if err := write(firefoxDirs, "allowed_extensions", addons); err != nil {
+		return written, err
+	}
+
+	if runtime.GOOS == "windows" {
+		return written, registerNativeHostWindows(written)
+	}
+	return written, nil
+}
+
+func isChromiumExtensionID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, c := range id {
+		if c < 'a' || c > 'p' {
+			return false
+		}
+	}
+	return true
+}
+
+// nativeHostDirs lists the manifest folders of browsers that are installed.
+// Windows keeps the manifests in our config folder and points the registry
+// at them.
+func nativeHostDirs() (chrome, firefox []string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var browsers []string
+	var mozilla string
+	switch runtime.GOOS {
+	case "darwin":
+		support := filepath.Join(home, "Library", "Application Support")
+		browsers = []string{
+			filepath.Join(support, "Google", "Chrome"),
+			filepath.Join(support, "Chromium"),
+			filepath.Join(support, "Microsoft Edge"),
+			filepath.Join(support, "BraveSoftware", "Brave-Browser"),
+		}
+		mozilla = filepath.Join(support, "Mozilla")
+		firefox = []string{filepath.Join(mozilla, "NativeMessagingHosts")}
+	case "windows":
+		config, err := os.UserConfigDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		base := filepath.Join(config, "com.chunkeddownloader.app")
+		return []string{filepath.Join(base, "chrome")}, []string{filepath.Join(base, "firefox")}, nil
+	default:
+		config := filepath.Join(home, ".config")
+		browsers = []string{
+			filepath.Join(config, "google-chrome"),
+			filepath.Join(config, "chromium"),
+			filepath.Join(config, "microsoft-edge"),
+			filepath.Join(config, "BraveSoftware", "Brave-Browser"),
+		}
+		mozilla = filepath.Join(home, ".mozilla")
+		firefox = []string{filepath.Join(mozilla, "native-messaging-hosts")}
+	}
+
+	for _, dir := range browsers {
+		if _, err := os.Stat(dir); err == nil {
+			chrome = append(chrome, filepath.Join(dir, "NativeMessagingHosts"))
+		}
+	}
+	if _, err := os.Stat(mozilla); err != nil {
+		firefox = nil
+	}
+	return chrome, firefox, nil
+}
+
+// registerNativeHostWindows points the browsers' registry keys at the
+// manifests written to our config folder.
+func registerNativeHostWindows(manifests []string) error {
+	for _, path := range manifests {
+		var keys []string
+		if strings.Contains(path, string(filepath.Separator)+"firefox"+string(filepath.Separator)) {
+			keys = []string{`HKCU\Software\Mozilla\NativeMessagingHosts\` + nativeHostName}
+		} else {
+			keys = []string{
+				`HKCU\Software\Google\Chrome\NativeMessagingHosts\` + nativeHostName,
+				`HKCU\Software\Microsoft\Edge\NativeMessagingHosts\` + nativeHostName,
+			}
+		}
+		for _, key := range keys {
+			cmd := exec.Command("reg", "add", key, "/ve", "/t", "REG_SZ", "/d", path, "/f")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("reg add %s: %v: %s", key, err, out)
+			}
+		}
+	}
+	return nil
+}
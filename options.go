@@ -0,0 +1,511 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Chunks fetched at the same time unless the task says otherwise
+const defaultConnections = 3
+
+// Task priorities. Higher ones start first when a download window opens
+// and get a bigger share of the global speed limit.
+const (
+	priorityLow    = -1
+	priorityNormal = 0
+	priorityHigh   = 1
+)
+
+var priorityNames = []string{"Low", "Normal", "High"}
+
+// taskOptions are overrides for one download, set in the "Add with options"
+// dialog or remembered for a domain. Zero values keep the global setting,
+// unless explicit marks them as chosen on purpose.
+type taskOptions struct {
+	Dir         string            `json:"dir,omitempty"`
+	Chunks      int               `json:"chunks,omitempty"`
+	Connections int               `json:"connections,omitempty"`
+	SpeedLimit  int64             `json:"speedLimit,omitempty"` // KB/s
+	Headers     map[string]string `json:"headers,omitempty"`
+	Priority    int               `json:"priority,omitempty"`
+	StartPaused bool              `json:"startPaused,omitempty"`
+	Proxy       string            `json:"proxy,omitempty"`
+	OpenFolder  bool              `json:"openFolder,omitempty"` // Show the file once it is done
+	Command     string            `json:"command,omitempty"`    // Run once the file is done
+	explicit    optionFields      // Fields that override even when zero
+}
+
+// optionFields is a set of taskOptions fields.
+type optionFields uint
+
+const (
+	fieldDir optionFields = 1 << iota
+	fieldConnections
+	fieldSpeedLimit
+	fieldHeaders
+	fieldPriority
+	fieldStartPaused
+	fieldProxy
+	fieldOpenFolder
+	fieldCommand
+
+	// Chunks is left out: a task always needs a chunk count
+	allOptionFields = fieldCommand<<1 - 1
+)
+
+// sets reports whether o overrides field, which it does when the value is
+// not zero or the field is explicit.
+func (o taskOptions) sets(field optionFields, nonZero bool) bool {
+	return nonZero || o.explicit&field != 0
+}
+
+func (o taskOptions) apply(task *DownloadTask) {
+	if o.sets(fieldDir, o.Dir != "") {
+		task.OutputDir = o.Dir
+	}
+	if o.Chunks > 0 {
+		task.ChunkCount = o.Chunks
+	}
+	if o.sets(fieldConnections, o.Connections > 0) {
+		task.Connections = o.Connections
+	}
+	if o.sets(fieldSpeedLimit, o.SpeedLimit > 0) {
+		task.limiter = nil
+		if o.SpeedLimit > 0 {
+			task.limiter = &rateLimiter{}
+			task.limiter.setRate(o.SpeedLimit * 1024)
+		}
+	}
+	if o.sets(fieldHeaders, len(o.Headers) > 0) {
+		task.Headers = mergeHeaders(task.Headers, o.Headers, o.explicit&fieldHeaders != 0)
+	}
+	if o.sets(fieldPriority, o.Priority != priorityNormal) {
+		task.Priority = o.Priority
+	}
+	if o.sets(fieldStartPaused, o.StartPaused) {
+		task.held = o.StartPaused
+	}
+	if o.sets(fieldProxy, o.Proxy != "") {
+		task.Proxy = o.Proxy
+	}
+	if o.sets(fieldOpenFolder, o.OpenFolder) {
+		task.OpenFolder = o.OpenFolder
+	}
+	if o.sets(fieldCommand, o.Command != "") {
+		task.OnComplete = o.Command
+	}
+}
+
+// merge returns o with the fields set in over replacing its own.
+func (o taskOptions) merge(over taskOptions) taskOptions {
+	if over.sets(fieldDir, over.Dir != "") {
+		o.Dir = over.Dir
+	}
+	if over.Chunks > 0 {
+		o.Chunks = over.Chunks
+	}
+	if over.sets(fieldConnections, over.Connections > 0) {
+		o.Connections = over.Connections
+	}
+	if over.sets(fieldSpeedLimit, over.SpeedLimit > 0) {
+		o.SpeedLimit = over.SpeedLimit
+	}
+	if over.sets(fieldHeaders, len(over.Headers) > 0) {
+		o.Headers = mergeHeaders(o.Headers, over.Headers, over.explicit&fieldHeaders != 0)
+	}
+	if over.sets(fieldPriority, over.Priority != priorityNormal) {
+		o.Priority = over.Priority
+	}
+	if over.sets(fieldStartPaused, over.StartPaused) {
+		o.StartPaused = over.StartPaused
+	}
+	if over.sets(fieldProxy, over.Proxy != "") {
+		o.Proxy = over.Proxy
+	}
+	if over.sets(fieldOpenFolder, over.OpenFolder) {
+		o.OpenFolder = over.OpenFolder
+	}
+	if over.sets(fieldCommand, over.Command != "") {
+		o.Command = over.Command
+	}
+	o.explicit |= over.explicit
+	return o
+}
+
+// mergeHeaders returns a copy of base with over added, or of over alone
+// when it replaces base.
+func mergeHeaders(base, over map[string]string, replace bool) map[string]string {
+	header := map[string]string{}
+	if !replace {
+		for k, v := range base {
+			header[k] = v
+		}
+	}
+	for k, v := range over {
+		header[k] = v
+	}
+	if len(header) == 0 {
+		return nil
+	}
+	return header
+}
+
+// connections is how many of the task's chunks download at once.
+func (task *DownloadTask) connections() int {
+	if task.Connections > 0 {
+		return task.Connections
+	}
+	return defaultConnections
+}
+
+// priorityCost is what n bytes count for against the global speed limit.
+func priorityCost(priority, n int) int {
+	switch {
+	case priority > priorityNormal:
+		return max(n/2, 1)
+	case priority < priorityNormal:
+		return n * 2
+	}
+	return n
+}
+
+// startHeld starts a task that was added paused. It reports false for any
+// other task.
+func (d *Downloader) startHeld(task *DownloadTask) bool {
+	if !task.held || task.Status != "Paused" {
+		return false
+	}
+	task.held = false
+
+	if d.scheduler.holding() {
+		task.Status = "Scheduled"
+		fyne.Do(func() {
+			task.updateStatusDisplay()
+			task.speedLabel.SetText("Waiting for download window")
+			task.actionButton.SetIcon(theme.MediaPauseIcon())
+		})
+		d.updateStats()
+		return true
+	}
+
+	task.Status = "Preparing..."
+	fyne.Do(func() {
+		task.updateStatusDisplay()
+		task.speedLabel.SetText("-- MB/s")
+		task.actionButton.SetIcon(theme.MediaPauseIcon())
+	})
+	go d.startDownload(task)
+	d.updateStats()
+	return true
+}
+
+// parseHeaderLines reads "Name: value" lines.
+func parseHeaderLines(text string) (map[string]string, error) {
+	header := map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header line %q", line)
+		}
+		header[name] = strings.TrimSpace(value)
+	}
+	return header, nil
+}
+
+func formatHeaderLines(header map[string]string) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\n", name, header[name])
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// parseChecksum reads "sha-256:hex", aria2's "sha-256=hex", or a bare hex
+// digest whose type is told by its length.
+func parseChecksum(text string) (hashType, sum string, err error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	hashType, sum, ok := strings.Cut(text, ":")
+	if !ok {
+		hashType, sum, ok = strings.Cut(text, "=")
+	}
+	if !ok {
+		sum = text
+		switch len(sum) {
+		case 32:
+			hashType = "md5"
+		case 40:
+			hashType = "sha-1"
+		case 64:
+			hashType = "sha-256"
+		case 128:
+			hashType = "sha-512"
+		default:
+			return "", "", fmt.Errorf("cannot tell the checksum type; write it as sha-256:<hex>")
+		}
+	}
+
+	hashType = strings.TrimSpace(hashType)
+	if !strings.Contains(hashType, "-") && strings.HasPrefix(hashType, "sha") {
+		hashType = "sha-" + hashType[3:]
+	}
+	switch hashType {
+	case "md5", "sha-1", "sha-256", "sha-512":
+	default:
+		return "", "", fmt.Errorf("unsupported checksum type %q", hashType)
+	}
+	sum = strings.TrimSpace(sum)
+	if _, err := hex.DecodeString(sum); err != nil || sum == "" {
+		return "", "", fmt.Errorf("checksum is not hexadecimal")
+	}
+	return hashType, sum, nil
+}
+
+// optionsForm holds the fields the Add with Options dialog and the rule
+// editor share.
+type optionsForm struct {
+	folder      *widget.Entry
+	chunks      *widget.Entry
+	connections *widget.Entry
+	limit       *widget.Entry
+	headers     *widget.Entry
+	priority    *widget.Select
+	paused      *widget.Check
+	proxy       *widget.Entry
+	openFolder  *widget.Check
+	command     *widget.Entry
+	items       []*widget.FormItem
+}
+
+func (d *Downloader) newOptionsForm() *optionsForm {
+	f := &optionsForm{}
+	f.folder = widget.NewEntry()
+	f.folder.SetPlaceHolder(d.outputFolder)
+	folderBtn := widget.NewButton("Browse...", func() {
+		dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err == nil && uri != nil {
+				f.folder.SetText(uri.Path())
+			}
+		}, d.window)
+	})
+
+	f.chunks = widget.NewEntry()
+	f.chunks.SetPlaceHolder(strconv.Itoa(d.chunkCount))
+	f.connections = widget.NewEntry()
+	f.connections.SetPlaceHolder(strconv.Itoa(defaultConnections))
+	f.limit = widget.NewEntry()
+	f.limit.SetPlaceHolder("Unlimited")
+
+	f.headers = widget.NewMultiLineEntry()
+	f.headers.SetPlaceHolder("Referer: https://example.com/\nCookie: session=abc")
+	f.headers.SetMinRowsVisible(3)
+
+	f.priority = widget.NewSelect(priorityNames, nil)
+	f.priority.SetSelected("Normal")
+	f.paused = widget.NewCheck("Start paused", nil)
+
+	f.proxy = widget.NewEntry()
+	f.proxy.SetPlaceHolder("socks5://127.0.0.1:1080")
+	f.openFolder = widget.NewCheck("Open the folder when done", nil)
+	f.command = widget.NewEntry()
+	f.command.SetPlaceHolder(`unzip -o "{file}"`)
+
+	f.items = []*widget.FormItem{
+		widget.NewFormItem("Folder", container.NewBorder(nil, nil, nil, folderBtn, f.folder)),
+		widget.NewFormItem("Chunks", f.chunks),
+		widget.NewFormItem("Connections", f.connections),
+		widget.NewFormItem("Speed limit (KB/s)", f.limit),
+		widget.NewFormItem("Headers", f.headers),
+		widget.NewFormItem("Priority", f.priority),
+		widget.NewFormItem("Proxy", f.proxy),
+		widget.NewFormItem("Run when done", f.command),
+	}
+	return f
+}
+
+func (f *optionsForm) set(opts taskOptions) {
+	f.folder.SetText(opts.Dir)
+	f.chunks.SetText("")
+	if opts.Chunks > 0 {
+		f.chunks.SetText(strconv.Itoa(opts.Chunks))
+	}
+	f.connections.SetText("")
+	if opts.Connections > 0 {
+		f.connections.SetText(strconv.Itoa(opts.Connections))
+	}
+	f.limit.SetText("")
+	if opts.SpeedLimit > 0 {
+		f.limit.SetText(strconv.FormatInt(opts.SpeedLimit, 10))
+	}
+	f.headers.SetText(formatHeaderLines(opts.Headers))
+	f.priority.SetSelected(priorityNames[min(max(opts.Priority, priorityLow), priorityHigh)+1])
+	f.paused.SetChecked(opts.StartPaused)
+	f.proxy.SetText(opts.Proxy)
+	f.openFolder.SetChecked(opts.OpenFolder)
+	f.command.SetText(opts.Command)
+}
+
+// options reads the form.
+func (f *optionsForm) options() (taskOptions, error) {
+	opts := taskOptions{
+		Dir:         strings.TrimSpace(f.folder.Text),
+		Priority:    slices.Index(priorityNames, f.priority.Selected) - 1,
+		StartPaused: f.paused.Checked,
+		Proxy:       strings.TrimSpace(f.proxy.Text),
+		OpenFolder:  f.openFolder.Checked,
+		Command:     strings.TrimSpace(f.command.Text),
+	}
+	var err error
+	if opts.Proxy != "" {
+		if _, err := parseProxy(opts.Proxy); err != nil {
+			return opts, err
+		}
+	}
+	if opts.Chunks, err = optionalCount(f.chunks.Text, "Chunks"); err != nil {
+		return opts, err
+	}
+	if opts.Connections, err = optionalCount(f.connections.Text, "Connections"); err != nil {
+		return opts, err
+	}
+	if text := strings.TrimSpace(f.limit.Text); text != "" {
+		if opts.SpeedLimit, err = strconv.ParseInt(text, 10, 64); err != nil || opts.SpeedLimit < 0 {
+			return opts, fmt.Errorf("Speed limit must be a whole number of KB/s")
+		}
+	}
+	if opts.Headers, err = parseHeaderLines(f.headers.Text); err != nil {
+		return opts, err
+	}
+	if len(opts.Headers) == 0 {
+		opts.Headers = nil
+	}
+	return opts, nil
+}
+
+// showAddWithOptions adds one download with settings that apply to it only.
+func (d *Downloader) showAddWithOptions() {
+	urlEntry := widget.NewEntry()
+	urlEntry.SetPlaceHolder("https://example.com/file.iso")
+	urlEntry.SetText(strings.TrimSpace(d.urlEntry.Text))
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("From the server")
+	checksumEntry := widget.NewEntry()
+	checksumEntry.SetPlaceHolder("sha-256:9f86d081884c7d65...")
+
+	f := d.newOptionsForm()
+	rememberCheck := widget.NewCheck("Remember for this domain", nil)
+
+	// Start from what the rules say for this URL
+	if opts, ok := rulesFor(urlEntry.Text); ok {
+		f.set(opts)
+	}
+	rememberCheck.SetChecked(hasDomainRule(domainOf(urlEntry.Text)))
+
+	form := widget.NewForm(
+		widget.NewFormItem("URL", urlEntry),
+		widget.NewFormItem("File name", nameEntry),
+		widget.NewFormItem("Checksum", checksumEntry),
+	)
+	for _, item := range f.items {
+		form.AppendItem(item)
+	}
+	content := container.NewVBox(form,
+		container.NewHBox(f.paused, f.openFolder, rememberCheck),
+		widget.NewLabel("Empty fields use the settings. Options apply to single-file downloads."),
+	)
+
+	optionsDialog := dialog.NewCustomConfirm("Add with Options", "Add", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		urlStr := strings.TrimSpace(urlEntry.Text)
+		if urlStr == "" {
+			dialog.ShowError(fmt.Errorf("Please enter a URL"), d.window)
+			return
+		}
+
+		opts, err := f.options()
+		if err != nil {
+			dialog.ShowError(err, d.window)
+			return
+		}
+
+		var hashType, sum string
+		if strings.TrimSpace(checksumEntry.Text) != "" {
+			if hashType, sum, err = parseChecksum(checksumEntry.Text); err != nil {
+				dialog.ShowError(err, d.window)
+				return
+			}
+		}
+
+		if rememberCheck.Checked {
+			domain := domainOf(urlStr)
+			if domain == "" {
+				dialog.ShowError(fmt.Errorf("Only URLs with a host name can be remembered"), d.window)
+				return
+			}
+			rememberDomain(domain, opts)
+			d.saveSettings()
+		}
+
+		if strings.TrimSpace(d.urlEntry.Text) == urlStr {
+			d.urlEntry.SetText("")
+		}
+		fileName := strings.TrimSpace(nameEntry.Text)
+		// The form starts from the rules, so whatever it says now is meant
+		// for this download, including cleared fields
+		opts.explicit = allOptionFields
+		go func() {
+			_, err := d.addRemote([]string{urlStr}, func(task *DownloadTask) error {
+				opts.apply(task)
+				if fileName != "" {
+					task.FileName = filepath.Base(fileName)
+				}
+				if sum != "" {
+					task.ExpectedHashes = map[string]string{hashType: sum}
+				}
+				return nil
+			})
+			if err != nil {
+				fyne.Do(func() {
+					dialog.ShowError(err, d.window)
+				})
+			}
+		}()
+	}, d.window)
+
+	optionsDialog.Resize(fyne.NewSize(600, 640))
+	optionsDialog.Show()
+}
+
+// optionalCount reads a 1-50 count; empty means the setting.
+func optionalCount(text, what string) (int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil || n < 1 || n > 50 {
+		return 0, fmt.Errorf("%s must be between 1 and 50", what)
+	}
+	return n, nil
+}
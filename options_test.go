@@ -0,0 +1,77 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func ruleOptions() taskOptions {
+	return taskOptions{
+		Dir:         "/data/isos",
+		Chunks:      8,
+		Connections: 6,
+		SpeedLimit:  100,
+		Headers:     map[string]string{"Cookie": "a=b"},
+		Priority:    priorityHigh,
+		StartPaused: true,
+		Proxy:       "socks5://127.0.0.1:1080",
+		OpenFolder:  true,
+		Command:     "unzip {file}",
+	}
+}
+
+func TestTaskOptionsZeroKeepsRule(t *testing.T) {
+	task := &DownloadTask{ChunkCount: 4}
+	ruleOptions().apply(task)
+	taskOptions{}.apply(task)
+
+	if task.OutputDir != "/data/isos" || task.ChunkCount != 8 || task.Connections != 6 ||
+		task.limiter == nil || task.Headers["Cookie"] != "a=b" || task.Priority != priorityHigh ||
+		!task.held || task.Proxy == "" || !task.OpenFolder || task.OnComplete == "" {
+		t.Errorf("empty options changed the rule's settings: %+v", task)
+	}
+}
+
+func TestTaskOptionsExplicitZeroOverridesRule(t *testing.T) {
+	task := &DownloadTask{ChunkCount: 4}
+	ruleOptions().apply(task)
+	taskOptions{explicit: allOptionFields}.apply(task)
+
+	if task.OutputDir != "" || task.Connections != 0 || task.limiter != nil || task.Headers != nil ||
+		task.Priority != priorityNormal || task.held || task.Proxy != "" || task.OpenFolder || task.OnComplete != "" {
+		t.Errorf("explicit options did not clear the rule's settings: %+v", task)
+	}
+	if task.ChunkCount != 8 {
+		t.Errorf("chunk count %d, want the rule's 8", task.ChunkCount)
+	}
+
+	// Explicit headers replace the rule's rather than adding to them
+	task = &DownloadTask{}
+	ruleOptions().apply(task)
+	taskOptions{Headers: map[string]string{"Referer": "x"}, explicit: fieldHeaders}.apply(task)
+	if !maps.Equal(task.Headers, map[string]string{"Referer": "x"}) {
+		t.Errorf("headers %v, want only Referer", task.Headers)
+	}
+}
+
+func TestTaskOptionsMerge(t *testing.T) {
+	merged := ruleOptions().merge(taskOptions{Dir: "/other", Headers: map[string]string{"Referer": "x"}})
+	if merged.Dir != "/other" || !merged.StartPaused || merged.Command == "" ||
+		!maps.Equal(merged.Headers, map[string]string{"Cookie": "a=b", "Referer": "x"}) {
+		t.Errorf("merge with plain options: %+v", merged)
+	}
+
+	merged = ruleOptions().merge(taskOptions{explicit: fieldStartPaused | fieldCommand | fieldPriority})
+	if merged.StartPaused || merged.Command != "" || merged.Priority != priorityNormal {
+		t.Errorf("explicit fields were not cleared: %+v", merged)
+	}
+	if merged.Dir != "/data/isos" || !merged.OpenFolder {
+		t.Errorf("fields that were not explicit changed: %+v", merged)
+	}
+
+	task := &DownloadTask{}
+	merged.apply(task)
+	if task.held || task.OnComplete != "" {
+		t.Errorf("merged explicit fields were not applied: %+v", task)
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// How often /events looks for changes
+const eventInterval = 500 * time.Millisecond
+
+// restTask is the JSON form of a task. Chunks and hashes are only filled
+// in for the detail view.
+type restTask struct {
+	ID             string            `json:"id"`
+	URL            string            `json:"url"`
+	Mirrors        []string          `json:"mirrors,omitempty"`
+	File           string            `json:"file"`
+	Status         string            `json:"status"`
+	Size           int64             `json:"size"`
+	Downloaded     int64             `json:"downloaded"`
+	Progress       float64           `json:"progress"`
+	Speed          int64             `json:"speed"` // Bytes per second
+	Started        time.Time         `json:"started"`
+	Parent         string            `json:"parent,omitempty"`
+	Chunks         []restChunk       `json:"chunks,omitempty"`
+	Hashes         map[string]string `json:"hashes,omitempty"`
+	ExpectedHashes map[string]string `json:"expectedHashes,omitempty"`
+	ETag           string            `json:"etag,omitempty"`
+	LastModified   string            `json:"lastModified,omitempty"`
+}
+
+type restChunk struct {
+	Index      int    `json:"index"`
+	Start      int64  `json:"start"`
+	End        int64  `json:"end"`
+	Downloaded int64  `json:"downloaded"`
+	Status     string `json:"status"`
+	Mirror     string `json:"mirror,omitempty"`
+}
+
+// restNewTask is the body of POST /api/tasks.
+type restNewTask struct {
+	URL         string            `json:"url"`
+	Mirrors     []string          `json:"mirrors"`
+	Dir         string            `json:"dir"`
+	FileName    string            `json:"fileName"`
+	Connections int               `json:"connections"`
+	SpeedLimit  int64             `json:"speedLimit"` // Bytes per second
+	Checksums   map[string]string `json:"checksums"`  // e.g. {"sha-256": "..."}
+}
+
+// restSettings is the part of Settings that can be changed remotely.
+type restSettings struct {
+	DownloadFolder string  `json:"downloadFolder"`
+	Connections    int     `json:"connections"`
+	SeedRatio      float64 `json:"seedRatio"`
+	Schedule       struct {
+		Enabled      bool   `json:"enabled"`
+		Windows      string `json:"windows"`      // One per line, as in Settings
+		LimitInside  int64  `json:"limitInside"`  // KB/s
+		LimitOutside int64  `json:"limitOutside"` // KB/s
+	} `json:"schedule"`
+}
+
+type restEvent struct {
+	Type string    `json:"type"` // added, state, progress, completed, removed
+	Task *restTask `json:"task"`
+}
+
+func taskJSON(task *DownloadTask, detail bool) *restTask {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	t := &restTask{
+		ID:         task.ID,
+		URL:        task.URL,
+		Mirrors:    task.Mirrors,
+		File:       task.OutputFile,
+		Status:     task.Status,
+		Size:       task.TotalSize,
+		Downloaded: task.Downloaded,
+		Started:    task.StartTime,
+	}
+	if task.TotalSize > 0 {
+		t.Progress = float64(task.Downloaded) / float64(task.TotalSize)
+	}
+	if task.Status == "Downloading" {
+		t.Speed = int64(task.Speed)
+	}
+	if task.parent != nil {
+		t.Parent = task.parent.ID
+	}
+	if !detail {
+		return t
+	}
+
+	for _, chunk := range task.Chunks {
+		t.Chunks = append(t.Chunks, restChunk{
+			Index:      chunk.Index,
+			Start:      chunk.Start,
+			End:        chunk.End,
+			Downloaded: chunk.Downloaded,
+			Status:     chunk.Status,
+			Mirror:     chunk.Mirror,
+		})
+	}
+	if task.MD5Hash != "" {
+		t.Hashes = map[string]string{"md5": task.MD5Hash, "sha-256": task.SHA256Hash}
+	}
+	t.ExpectedHashes = task.ExpectedHashes
+	t.ETag = task.ETag
+	t.LastModified = task.LastModified
+	return t
+}
+
+// registerREST adds the native API under /api, each handler wrapped in
+// auth.
+func (d *Downloader) registerREST(mux *http.ServeMux, auth func(http.HandlerFunc) http.HandlerFunc) {
+	mux.HandleFunc("GET /api/tasks", auth(d.restListTasks))
+	mux.HandleFunc("POST /api/tasks", auth(d.restCreateTask))
+	mux.HandleFunc("GET /api/tasks/{id}", auth(d.restGetTask))
+	mux.HandleFunc("DELETE /api/tasks/{id}", auth(d.restDeleteTask))
+	mux.HandleFunc("POST /api/tasks/{id}/pause", auth(d.restPauseTask))
+	mux.HandleFunc("POST /api/tasks/{id}/resume", auth(d.restResumeTask))
+	mux.HandleFunc("GET /api/stats", auth(d.restStats))
+	mux.HandleFunc("GET /api/settings", auth(d.restGetSettings))
+	mux.HandleFunc("PUT /api/settings", auth(d.restPutSettings))
+	mux.HandleFunc("GET /api/events", auth(d.restEvents))
+}
+
+// restPreflight answers CORS preflight for dashboards served from elsewhere.
+func restPreflight(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restAuth checks the secret, sent as a bearer token or, for EventSource
+// which cannot set headers, a token query parameter.
+func (d *Downloader) restAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := d.config().RPC.Secret
+		if secret == "" {
+			// Same rule as the RPC endpoint: no secret, no browsers
+			if r.Header.Get("Origin") != "" {
+				restError(w, http.StatusForbidden, "set a secret to allow browser access")
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if given == "" {
+			given = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+			restError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func restJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func restError(w http.ResponseWriter, status int, msg string) {
+	restJSON(w, status, map[string]string{"error": msg})
+}
+
+// restListTasks lists tasks, optionally filtered by ?status= (comma
+// separated, case-insensitive) and ?q= (substring of URL or file).
+func (d *Downloader) restListTasks(w http.ResponseWriter, r *http.Request) {
+	var statuses []string
+	if s := r.URL.Query().Get("status"); s != "" {
+		statuses = strings.Split(strings.ToLower(s), ",")
+	}
+	q := strings.ToLower(r.URL.Query().Get("q"))
+
+	tasks := []*restTask{}
+	for _, task := range d.taskSnapshot() {
+		t := taskJSON(task, false)
+		if len(statuses) > 0 && !containsStatus(statuses, t.Status) {
+			continue
+		}
+		if q != "" && !strings.Contains(strings.ToLower(t.URL), q) &&
+			!strings.Contains(strings.ToLower(t.File), q) {
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	restJSON(w, http.StatusOK, tasks)
+}
+
+func containsStatus(statuses []string, status string) bool {
+	status = strings.ToLower(status)
+	for _, s := range statuses {
+		if strings.TrimSpace(s) == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Downloader) restCreateTask(w http.ResponseWriter, r *http.Request) {
+	var req restNewTask
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRPCRequest)).Decode(&req); err != nil {
+		restError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.URL) == "" {
+		restError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+
+	checksums := map[string]string{}
+	for algo, sum := range req.Checksums {
+		hashType := normalizeHashType(algo)
+		if hashType == "" {
+			restError(w, http.StatusBadRequest, fmt.Sprintf("unsupported checksum type %q", algo))
+			return
+		}
+		checksums[hashType] = strings.ToLower(sum)
+	}
+
+	urls := append([]string{req.URL}, req.Mirrors...)
+	task, err := d.addRemote(urls, func(task *DownloadTask) error {
+		if req.Dir != "" {
+			task.OutputDir = req.Dir
+		}
+		if req.FileName != "" {
+			task.FileName = filepath.Base(req.FileName)
+		}
+		if req.Connections > 0 {
+			task.ChunkCount = min(req.Connections, 50)
+		}
+		if req.SpeedLimit > 0 {
+			task.limiter = &rateLimiter{}
+			task.limiter.setRate(req.SpeedLimit)
+		}
+		for hashType, sum := range checksums {
+			if task.ExpectedHashes == nil {
+				task.ExpectedHashes = map[string]string{}
+			}
+			task.ExpectedHashes[hashType] = sum
+		}
+		return nil
+	})
+	if err != nil {
+		restError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if task == nil {
+		// Metalinks, streams and folders become tasks once they are read
+		restJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+		return
+	}
+	restJSON(w, http.StatusCreated, taskJSON(task, true))
+}
+
+func (d *Downloader) restTask(w http.ResponseWriter, r *http.Request) *DownloadTask {
+	d.mu.Lock()
+	task := d.tasks[r.PathValue("id")]
+	d.mu.Unlock()
+	if task == nil {
+		restError(w, http.StatusNotFound, "no such task")
+	}
+	return task
+}
+
+func (d *Downloader) restGetTask(w http.ResponseWriter, r *http.Request) {
+	if task := d.restTask(w, r); task != nil {
+		restJSON(w, http.StatusOK, taskJSON(task, true))
+	}
+}
+
+// restDeleteTask cancels the task if it is running and removes it.
+func (d *Downloader) restDeleteTask(w http.ResponseWriter, r *http.Request) {
+	if task := d.restTask(w, r); task != nil {
+		d.removeTask(task)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (d *Downloader) restPauseTask(w http.ResponseWriter, r *http.Request) {
+	if task := d.restTask(w, r); task != nil {
+		if !d.pauseTask(task) {
+			restError(w, http.StatusConflict, fmt.Sprintf("task is %s", task.Status))
+			return
+		}
+		restJSON(w, http.StatusOK, taskJSON(task, false))
+	}
+}
+
+func (d *Downloader) restResumeTask(w http.ResponseWriter, r *http.Request) {
+	if task := d.restTask(w, r); task != nil {
+		if !d.resumeTask(task) {
+			restError(w, http.StatusConflict, fmt.Sprintf("task is %s", task.Status))
+			return
+		}
+		restJSON(w, http.StatusOK, taskJSON(task, false))
+	}
+}
+
+func (d *Downloader) restStats(w http.ResponseWriter, r *http.Request) {
+	counts := map[string]int{}
+	var speed float64
+	for _, task := range d.taskSnapshot() {
+		counts[task.Status]++
+		if task.Status == "Downloading" {
+			speed += task.Speed
+		}
+	}
+	restJSON(w, http.StatusOK, map[string]any{
+		"tasks":         counts,
+		"speed":         int64(speed),
+		"outsideWindow": d.scheduler.holding(),
+	})
+}
+
+func (d *Downloader) currentSettings() restSettings {
+	var rs restSettings
+	rs.DownloadFolder = d.outputFolder
+	rs.Connections = d.chunkCount
+	rs.SeedRatio = d.config().SeedRatio
+	schedule := d.scheduler.current()
+	rs.Schedule.Enabled = schedule.Enabled
+	rs.Schedule.Windows = formatScheduleWindows(schedule.Windows)
+	rs.Schedule.LimitInside = schedule.LimitInside
+	rs.Schedule.LimitOutside = schedule.LimitOutside
+	return rs
+}
+
+func (d *Downloader) restGetSettings(w http.ResponseWriter, r *http.Request) {
+	restJSON(w, http.StatusOK, d.currentSettings())
+}
+
+// restPutSettings replaces the settings and saves them like the dialog does.
+func (d *Downloader) restPutSettings(w http.ResponseWriter, r *http.Request) {
+	rs := d.currentSettings()
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRPCRequest)).Decode(&rs); err != nil {
+		restError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	windows, err := parseScheduleWindows(rs.Schedule.Windows)
+	switch {
+	case err != nil:
+		restError(w, http.StatusBadRequest, err.Error())
+		return
+	case rs.DownloadFolder == "" || !filepath.IsAbs(rs.DownloadFolder):
+		restError(w, http.StatusBadRequest, "downloadFolder must be an absolute path")
+		return
+	case rs.Connections < 1 || rs.Connections > 50:
+		restError(w, http.StatusBadRequest, "connections must be between 1 and 50")
+		return
+	case rs.SeedRatio < 0:
+		restError(w, http.StatusBadRequest, "seedRatio must not be negative")
+		return
+	}
+
+	fyne.DoAndWait(func() {
+		d.outputFolder = rs.DownloadFolder
+		d.chunkCount = rs.Connections
+		d.setConfig(func(s *appSettings) { s.SeedRatio = rs.SeedRatio })
+		d.scheduler.configure(scheduleSettings{
+			Enabled:      rs.Schedule.Enabled && len(windows) > 0,
+			Windows:      windows,
+			LimitInside:  max(rs.Schedule.LimitInside, 0),
+			LimitOutside: max(rs.Schedule.LimitOutside, 0),
+		})
+		d.saveSettings()
+	})
+	go d.scheduleTick()
+	restJSON(w, http.StatusOK, d.currentSettings())
+}
+
+// restEvents streams task changes as server-sent events. Each connection
+// compares snapshots on its own, so a slow client only delays itself.
+func (d *Downloader) restEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		restError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(ev restEvent) bool {
+		data, _ := json.Marshal(ev)
+		_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		return err == nil
+	}
+
+	// New subscribers first hear about every existing task
+	last := map[string]*restTask{}
+	ticker := time.NewTicker(eventInterval)
+	defer ticker.Stop()
+	idle := 0
+	for {
+		seen := map[string]bool{}
+		for _, task := range d.taskSnapshot() {
+			t := taskJSON(task, false)
+			seen[t.ID] = true
+			prev := last[t.ID]
+			last[t.ID] = t
+
+			var ev string
+			switch {
+			case prev == nil:
+				ev = "added"
+			case prev.Status != t.Status && (t.Status == "Completed" || t.Status == "Up to date"):
+				ev = "completed"
+			case prev.Status != t.Status:
+				ev = "state"
+			case prev.Downloaded != t.Downloaded || prev.Size != t.Size:
+				ev = "progress"
+			default:
+				continue
+			}
+			if !send(restEvent{Type: ev, Task: t}) {
+				return
+			}
+			idle = 0
+		}
+		for id, t := range last {
+			if !seen[id] {
+				delete(last, id)
+				if !send(restEvent{Type: "removed", Task: t}) {
+					return
+				}
+			}
+		}
+
+		// Comment lines keep proxies from closing a quiet stream
+		if idle++; idle >= 30 {
+			idle = 0
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/test"
+	"fyne.io/fyne/v2/widget"
+)
+
+// newRemoteTestDownloader returns a downloader whose tasks stay queued
+// outside the schedule's only window, so nothing is fetched.
+func newRemoteTestDownloader(t *testing.T) *Downloader {
+	app := test.NewApp()
+	windows, err := parseScheduleWindows("daily 01:00-02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Downloader{
+		app:          app,
+		window:       app.NewWindow(""),
+		tasks:        map[string]*DownloadTask{},
+		taskList:     container.NewVBox(),
+		statsLabel:   widget.NewLabel(""),
+		outputFolder: t.TempDir(),
+		chunkCount:   4,
+		scheduler:    newScheduler(),
+		limiter:      &rateLimiter{},
+		settings:     defaultSettings(),
+	}
+	d.scheduler.clock = &fakeClock{now: at(1, 12, 0)}
+	d.scheduler.configure(scheduleSettings{Enabled: true, Windows: windows})
+	d.scheduleTick()
+	return d
+}
+
+func postTask(d *Downloader, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/api/tasks", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	d.restCreateTask(w, r)
+	return w
+}
+
+func TestRESTCreateTaskChecksums(t *testing.T) {
+	d := newRemoteTestDownloader(t)
+
+	w := postTask(d, `{"url": "https://example.com/a.iso", "checksums": {"SHA256": "ABCDEF", "sha1": "123456"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	d.mu.Lock()
+	task := d.tasks[created.ID]
+	d.mu.Unlock()
+	if task == nil {
+		t.Fatal("no task was added")
+	}
+	want := map[string]string{"sha-256": "abcdef", "sha-1": "123456"}
+	if len(task.ExpectedHashes) != len(want) {
+		t.Fatalf("hashes %v, want %v", task.ExpectedHashes, want)
+	}
+	for k, v := range want {
+		if task.ExpectedHashes[k] != v {
+			t.Errorf("hashes %v, want %v", task.ExpectedHashes, want)
+		}
+	}
+
+	w = postTask(d, `{"url": "https://example.com/b.iso", "checksums": {"crc32": "abcdef"}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown checksum type: status %d, want 400", w.Code)
+	}
+	if len(d.tasks) != 1 {
+		t.Errorf("%d tasks after a rejected request, want 1", len(d.tasks))
+	}
+}
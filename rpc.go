@@ -0,0 +1,834 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"golang.org/x/net/websocket"
+)
+
+// rpcSettings configures the local control server: aria2-compatible
+// JSON-RPC for aria2 scripts and browser extensions, and the native REST
+// API. Both share the port and secret.
+type rpcSettings struct {
+	Enabled bool // aria2 JSON-RPC on /jsonrpc
+	REST    bool // Native API on /api
+	Port    int  // aria2 uses 6800
+	Secret  string
+}
+
+// Biggest request body we accept
+const maxRPCRequest = 1 << 20
+
+// JSON-RPC error codes; aria2 reports all of its own failures as 1.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcFailed         = 1
+)
+
+type rpcRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+func rpcErrorf(format string, args ...any) *rpcError {
+	return &rpcError{Code: rpcFailed, Message: fmt.Sprintf(format, args...)}
+}
+
+// startRPC (re)starts the server to match the RPC settings.
+func (d *Downloader) startRPC() {
+	d.mu.Lock()
+	old := d.rpcServer
+	d.rpcServer = nil
+	d.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	cfg := d.config().RPC
+	if !cfg.Enabled && !cfg.REST {
+		return
+	}
+
+	mux := http.NewServeMux()
+	if cfg.Enabled {
+		mux.HandleFunc("/jsonrpc", d.serveRPC)
+	}
+	if cfg.REST {
+		d.registerREST(mux, d.restAuth)
+		mux.HandleFunc("OPTIONS /api/", restPreflight)
+	}
+	srv := &http.Server{
+		Addr:              net.JoinHostPort("127.0.0.1", strconv.Itoa(cfg.Port)),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("Remote control server not started: %v", err), d.window)
+		})
+		return
+	}
+	d.mu.Lock()
+	d.rpcServer = srv
+	d.mu.Unlock()
+	go srv.Serve(ln)
+}
+
+// serveRPC answers POSTed JSON-RPC calls and upgrades to WebSocket when the
+// client asks for it, like aria2 does on the same path.
+func (d *Downloader) serveRPC(w http.ResponseWriter, r *http.Request) {
+	// Without a secret any web page could post here; only let local tools in
+	if d.config().RPC.Secret == "" && r.Header.Get("Origin") != "" {
+		http.Error(w, "set an RPC secret to allow browser access", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		websocket.Server{
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler:   d.serveRPCSocket,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "POST JSON-RPC requests here", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRPCRequest))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json-rpc")
+	w.Write(d.handleRPC(body))
+}
+
+func (d *Downloader) serveRPCSocket(ws *websocket.Conn) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = maxRPCRequest
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			return
+		}
+		if err := websocket.Message.Send(ws, string(d.handleRPC(msg))); err != nil {
+			return
+		}
+	}
+}
+
+// handleRPC runs a single call or a batch and returns the encoded reply.
+func (d *Downloader) handleRPC(body []byte) []byte {
+	body = []byte(strings.TrimSpace(string(body)))
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return encodeRPC(rpcResponse{Error: &rpcError{Code: rpcParseError, Message: "Parse error"}})
+		}
+		replies := make([]rpcResponse, 0, len(batch))
+		for _, raw := range batch {
+			replies = append(replies, d.callRPC(raw))
+		}
+		data, _ := json.Marshal(replies)
+		return data
+	}
+	return encodeRPC(d.callRPC(body))
+}
+
+func encodeRPC(resp rpcResponse) []byte {
+	data, _ := json.Marshal(resp)
+	return data
+}
+
+func (d *Downloader) callRPC(raw json.RawMessage) rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &rpcError{Code: rpcParseError, Message: "Parse error"}}
+	}
+	resp := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	if resp.ID == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	if req.Method == "" {
+		resp.Error = &rpcError{Code: rpcInvalidRequest, Message: "Invalid Request"}
+		return resp
+	}
+
+	result, err := d.dispatchRPC(req.Method, req.Params)
+	if err != nil {
+		resp.Error = err
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
+
+// checkToken strips the "token:SECRET" first parameter aria2 clients send.
+func checkToken(params []json.RawMessage, secret string) ([]json.RawMessage, *rpcError) {
+	var token string
+	hasToken := len(params) > 0 && json.Unmarshal(params[0], &token) == nil &&
+		strings.HasPrefix(token, "token:")
+	if hasToken {
+		params = params[1:]
+	}
+	if secret == "" {
+		return params, nil
+	}
+	given := strings.TrimPrefix(token, "token:")
+	if !hasToken || subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+		return nil, &rpcError{Code: rpcFailed, Message: "Unauthorized"}
+	}
+	return params, nil
+}
+
+var rpcMethods = []string{
+	"aria2.addUri", "aria2.remove", "aria2.forceRemove", "aria2.pause", "aria2.forcePause",
+	"aria2.pauseAll", "aria2.forcePauseAll", "aria2.unpause", "aria2.unpauseAll",
+	"aria2.tellStatus", "aria2.tellActive", "aria2.tellWaiting", "aria2.tellStopped",
+	"aria2.getGlobalStat", "aria2.changeOption", "aria2.changeGlobalOption",
+	"aria2.getVersion", "aria2.removeDownloadResult", "aria2.purgeDownloadResult",
+	"system.multicall", "system.listMethods",
+}
+
+func (d *Downloader) dispatchRPC(method string, params []json.RawMessage) (any, *rpcError) {
+	// system.* calls carry no token of their own
+	if method == "system.listMethods" {
+		return rpcMethods, nil
+	}
+	if method == "system.multicall" {
+		return d.rpcMulticall(params)
+	}
+
+	params, err := checkToken(params, d.config().RPC.Secret)
+	if err != nil {
+		return nil, err
+	}
+	p := rpcParams(params)
+
+	switch method {
+	case "aria2.addUri":
+		return d.rpcAddURI(p)
+	case "aria2.remove", "aria2.forceRemove", "aria2.removeDownloadResult":
+		task, err := d.taskForGID(p)
+		if err != nil {
+			return nil, err
+		}
+		d.removeTask(task)
+		if method == "aria2.removeDownloadResult" {
+			return "OK", nil
+		}
+		return taskGID(task), nil
+	case "aria2.pause", "aria2.forcePause":
+		task, err := d.taskForGID(p)
+		if err != nil {
+			return nil, err
+		}
+		if !d.pauseTask(task) {
+			return nil, rpcErrorf("GID#%s cannot be paused now", taskGID(task))
+		}
+		return taskGID(task), nil
+	case "aria2.unpause":
+		task, err := d.taskForGID(p)
+		if err != nil {
+			return nil, err
+		}
+		if !d.resumeTask(task) {
+			return nil, rpcErrorf("GID#%s cannot be unpaused now", taskGID(task))
+		}
+		return taskGID(task), nil
+	case "aria2.pauseAll", "aria2.forcePauseAll":
+		for _, task := range d.taskSnapshot() {
+			d.pauseTask(task)
+		}
+		return "OK", nil
+	case "aria2.unpauseAll":
+		for _, task := range d.taskSnapshot() {
+			d.resumeTask(task)
+		}
+		return "OK", nil
+	case "aria2.tellStatus":
+		task, err := d.taskForGID(p)
+		if err != nil {
+			return nil, err
+		}
+		return filterKeys(taskStatus(task), p.keys(1)), nil
+	case "aria2.tellActive":
+		return d.tellTasks("active", 0, -1, p.keys(0)), nil
+	case "aria2.tellWaiting", "aria2.tellStopped":
+		offset, num := p.int(0), p.int(1)
+		which := "waiting"
+		if method == "aria2.tellStopped" {
+			which = "stopped"
+		}
+		return d.tellTasks(which, offset, num, p.keys(2)), nil
+	case "aria2.purgeDownloadResult":
+		fyne.Do(d.clearCompleted)
+		return "OK", nil
+	case "aria2.getGlobalStat":
+		return d.globalStat(), nil
+	case "aria2.changeOption":
+		task, err := d.taskForGID(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.changeTaskOptions(task, p.options(1)); err != nil {
+			return nil, err
+		}
+		return "OK", nil
+	case "aria2.changeGlobalOption":
+		if err := d.changeGlobalOptions(p.options(0)); err != nil {
+			return nil, err
+		}
+		return "OK", nil
+	case "aria2.getVersion":
+		// Clients enable features by the aria2 version they see
+		return map[string]any{
+			"version":         "1.37.0",
+			"enabledFeatures": []string{"BitTorrent", "HTTPS", "Metalink", "SFTP"},
+		}, nil
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: "Method not found: " + method}
+}
+
+// rpcMulticall runs [{methodName, params}, ...]; each result is wrapped in
+// a one-element array, each failure is an error object.
+func (d *Downloader) rpcMulticall(params []json.RawMessage) (any, *rpcError) {
+	var calls []struct {
+		MethodName string            `json:"methodName"`
+		Params     []json.RawMessage `json:"params"`
+	}
+	if len(params) == 0 || json.Unmarshal(params[0], &calls) != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "expected an array of calls"}
+	}
+	results := make([]any, 0, len(calls))
+	for _, call := range calls {
+		if call.MethodName == "system.multicall" {
+			results = append(results, rpcErrorf("recursive system.multicall forbidden"))
+			continue
+		}
+		result, err := d.dispatchRPC(call.MethodName, call.Params)
+		if err != nil {
+			results = append(results, err)
+		} else {
+			results = append(results, []any{result})
+		}
+	}
+	return results, nil
+}
+
+type rpcParams []json.RawMessage
+
+func (p rpcParams) string(i int) string {
+	var s string
+	if i < len(p) {
+		json.Unmarshal(p[i], &s)
+	}
+	return s
+}
+
+func (p rpcParams) int(i int) int {
+	var n int
+	if i < len(p) {
+		json.Unmarshal(p[i], &n)
+	}
+	return n
+}
+
+func (p rpcParams) keys(i int) []string {
+	var keys []string
+	if i < len(p) {
+		json.Unmarshal(p[i], &keys)
+	}
+	return keys
+}
+
+// options reads an aria2 option object, whose values are all strings.
+func (p rpcParams) options(i int) map[string]string {
+	opts := map[string]string{}
+	if i < len(p) {
+		var raw map[string]any
+		json.Unmarshal(p[i], &raw)
+		for k, v := range raw {
+			opts[k] = fmt.Sprint(v)
+		}
+	}
+	return opts
+}
+
+// taskGID is a stable aria2-style 16 hex digit ID for task.
+func taskGID(task *DownloadTask) string {
+	h := fnv.New64a()
+	h.Write([]byte(task.ID))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func (d *Downloader) taskSnapshot() []*DownloadTask {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tasks := make([]*DownloadTask, 0, len(d.tasks))
+	for _, task := range d.tasks {
+		tasks = append(tasks, task)
+	}
+	// Oldest first, as aria2 lists its queue
+	for i := 1; i < len(tasks); i++ {
+		for j := i; j > 0 && tasks[j].StartTime.Before(tasks[j-1].StartTime); j-- {
+			tasks[j], tasks[j-1] = tasks[j-1], tasks[j]
+		}
+	}
+	return tasks
+}
+
+func (d *Downloader) taskByGID(gid string) *DownloadTask {
+	for _, task := range d.taskSnapshot() {
+		if taskGID(task) == gid {
+			return task
+		}
+	}
+	return nil
+}
+
+func (d *Downloader) taskForGID(p rpcParams) (*DownloadTask, *rpcError) {
+	gid := p.string(0)
+	task := d.taskByGID(gid)
+	if task == nil {
+		return nil, rpcErrorf("GID %s is not found", gid)
+	}
+	return task, nil
+}
+
+// aria2Status maps our task states onto aria2's.
+func aria2Status(task *DownloadTask) string {
+	switch task.Status {
+	case "Scheduled", "Queued":
+		return "waiting"
+	case "Paused":
+		return "paused"
+	case "Failed":
+		return "error"
+	case "Completed", "Up to date":
+		return "complete"
+	case "Cancelled":
+		return "removed"
+	}
+	return "active"
+}
+
+// taskStatus builds an aria2 tellStatus reply; numbers are strings there.
+func taskStatus(task *DownloadTask) map[string]any {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	connections := 0
+	for _, chunk := range task.Chunks {
+		if chunk.Status == "Downloading" {
+			connections++
+		}
+	}
+	pieceLength := task.PieceLength
+	if pieceLength == 0 && len(task.Chunks) > 0 {
+		pieceLength = task.Chunks[0].End - task.Chunks[0].Start + 1
+	}
+	speed := int64(0)
+	if task.Status == "Downloading" {
+		speed = int64(task.Speed)
+	}
+
+	uris := []map[string]string{{"uri": task.URL, "status": "used"}}
+	for _, mirror := range task.Mirrors {
+		if mirror != task.URL {
+			uris = append(uris, map[string]string{"uri": mirror, "status": "waiting"})
+		}
+	}
+
+	status := map[string]any{
+		"gid":             taskGID(task),
+		"status":          aria2Status(task),
+		"totalLength":     strconv.FormatInt(task.TotalSize, 10),
+		"completedLength": strconv.FormatInt(task.Downloaded, 10),
+		"uploadLength":    "0",
+		"downloadSpeed":   strconv.FormatInt(speed, 10),
+		"uploadSpeed":     "0",
+		"connections":     strconv.Itoa(connections),
+		"numPieces":       strconv.Itoa(len(task.Chunks)),
+		"pieceLength":     strconv.FormatInt(pieceLength, 10),
+		"dir":             filepath.Dir(task.OutputFile),
+		"files": []map[string]any{{
+			"index":           "1",
+			"path":            task.OutputFile,
+			"length":          strconv.FormatInt(task.TotalSize, 10),
+			"completedLength": strconv.FormatInt(task.Downloaded, 10),
+			"selected":        "true",
+			"uris":            uris,
+		}},
+	}
+	if task.OutputFile == "" {
+		status["dir"] = ""
+		status["files"].([]map[string]any)[0]["path"] = ""
+	}
+	if task.Status == "Failed" {
+		status["errorCode"] = "1"
+		status["errorMessage"] = "Download failed"
+	}
+	return status
+}
+
+func filterKeys(status map[string]any, keys []string) map[string]any {
+	if len(keys) == 0 {
+		return status
+	}
+	filtered := map[string]any{}
+	for _, key := range keys {
+		if v, ok := status[key]; ok {
+			filtered[key] = v
+		}
+	}
+	return filtered
+}
+
+// tellTasks lists tasks in one of aria2's groups. A negative offset counts
+// from the end, newest first, as aria2 does.
+func (d *Downloader) tellTasks(which string, offset, num int, keys []string) []map[string]any {
+	var group []*DownloadTask
+	for _, task := range d.taskSnapshot() {
+		s := aria2Status(task)
+		switch which {
+		case "active":
+			if s == "active" {
+				group = append(group, task)
+			}
+		case "waiting":
+			if s == "waiting" || s == "paused" {
+				group = append(group, task)
+			}
+		case "stopped":
+			if s == "complete" || s == "error" || s == "removed" {
+				group = append(group, task)
+			}
+		}
+	}
+
+	if offset < 0 {
+		for i, j := 0, len(group)-1; i < j; i, j = i+1, j-1 {
+			group[i], group[j] = group[j], group[i]
+		}
+		offset = -offset - 1
+	}
+	if offset > len(group) {
+		offset = len(group)
+	}
+	group = group[offset:]
+	if num >= 0 && num < len(group) {
+		group = group[:num]
+	}
+
+	result := make([]map[string]any, 0, len(group))
+	for _, task := range group {
+		result = append(result, filterKeys(taskStatus(task), keys))
+	}
+	return result
+}
+
+func (d *Downloader) globalStat() map[string]string {
+	var speed float64
+	var active, waiting, stopped int
+	for _, task := range d.taskSnapshot() {
+		switch aria2Status(task) {
+		case "active":
+			active++
+			if task.Status == "Downloading" {
+				speed += task.Speed
+			}
+		case "waiting", "paused":
+			waiting++
+		default:
+			stopped++
+		}
+	}
+	return map[string]string{
+		"downloadSpeed":   strconv.FormatInt(int64(speed), 10),
+		"uploadSpeed":     "0",
+		"numActive":       strconv.Itoa(active),
+		"numWaiting":      strconv.Itoa(waiting),
+		"numStopped":      strconv.Itoa(stopped),
+		"numStoppedTotal": strconv.Itoa(stopped),
+	}
+}
+
+// pauseTask pauses a running download the same way the card's button does.
+func (d *Downloader) pauseTask(task *DownloadTask) bool {
+	if task.Status != "Downloading" {
+		return false
+	}
+	task.Status = "Paused"
+	fyne.Do(func() {
+		task.updateStatusDisplay()
+		task.actionButton.SetIcon(theme.MediaPlayIcon())
+	})
+	d.updateStats()
+	return true
+}
+
+func (d *Downloader) resumeTask(task *DownloadTask) bool {
+	if d.startHeld(task) {
+		return true
+	}
+	if task.Status != "Paused" {
+		return false
+	}
+	d.scheduler.takePaused(task)
+	task.Status = "Downloading"
+	fyne.Do(func() {
+		task.updateStatusDisplay()
+		task.actionButton.SetIcon(theme.MediaPauseIcon())
+	})
+	d.updateStats()
+	return true
+}
+
+// parseByteSize reads aria2 sizes such as "0", "500K" or "1.5M".
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "K"), strings.HasSuffix(s, "k"):
+		mult = 1024
+	case strings.HasSuffix(s, "M"), strings.HasSuffix(s, "m"):
+		mult = 1024 * 1024
+	case strings.HasSuffix(s, "G"), strings.HasSuffix(s, "g"):
+		mult = 1024 * 1024 * 1024
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * mult), nil
+}
+
+// applyTaskOptions sets the aria2 options we understand on a task that has
+// not started yet.
+func applyTaskOptions(task *DownloadTask, opts map[string]string) error {
+	for key, value := range opts {
+		switch key {
+		case "dir":
+			if value != "" {
+				task.OutputDir = value
+			}
+		case "out":
+			task.FileName = filepath.Base(value)
+		case "split", "max-connection-per-server":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid %s %q", key, value)
+			}
+			task.ChunkCount = min(n, 50)
+		case "max-download-limit":
+			rate, err := parseByteSize(value)
+			if err != nil {
+				return err
+			}
+			task.limiter = &rateLimiter{}
+			task.limiter.setRate(rate)
+		case "checksum":
+			// aria2 writes "sha-256=hex"
+			algo, sum, ok := strings.Cut(value, "=")
+			if !ok {
+				return fmt.Errorf("invalid checksum %q", value)
+			}
+			hashType := normalizeHashType(algo)
+			if hashType == "" {
+				return fmt.Errorf("unsupported checksum type %q", algo)
+			}
+			if task.ExpectedHashes == nil {
+				task.ExpectedHashes = map[string]string{}
+			}
+			task.ExpectedHashes[hashType] = strings.ToLower(sum)
+		}
+	}
+	return nil
+}
+
+func (d *Downloader) rpcAddURI(p rpcParams) (any, *rpcError) {
+	var uris []string
+	if len(p) == 0 || json.Unmarshal(p[0], &uris) != nil || len(uris) == 0 {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "expected an array of URIs"}
+	}
+	opts := p.options(1)
+
+	// Their tasks only exist once the list is read, so there is no GID to
+	// hand back yet
+	if expandsIntoTasks(uris[0]) {
+		return nil, rpcErrorf("%s expands into several downloads, which addUri cannot add; use the REST API or the app", uris[0])
+	}
+
+	task, err := d.addRemote(uris, func(task *DownloadTask) error {
+		return applyTaskOptions(task, opts)
+	})
+	if err != nil {
+		return nil, rpcErrorf("%v", err)
+	}
+	return taskGID(task), nil
+}
+
+// expandsIntoTasks reports whether urlStr is read to find its downloads,
+// as metalinks, streams and folders are, instead of becoming one task.
+func expandsIntoTasks(urlStr string) bool {
+	urlStr = strings.TrimSpace(urlStr)
+	if filepath.IsAbs(urlStr) {
+		urlStr = fileURL(urlStr)
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil || isTorrentURL(urlStr) {
+		return false
+	}
+	_, lister := sourceFor(urlStr).(directorySource)
+	return isMetalinkURL(urlStr) || isStreamURL(urlStr) || isHTTPFolderURL(urlStr) ||
+		(lister && strings.HasSuffix(u.Path, "/"))
+}
+
+// addRemote adds a download requested from outside the window. Extra URLs
+// are mirrors of the first. URLs that expand into several tasks are queued
+// as if typed in and return a nil task.
+func (d *Downloader) addRemote(urls []string, configure func(*DownloadTask) error) (*DownloadTask, error) {
+	urlStr := strings.TrimSpace(urls[0])
+	if filepath.IsAbs(urlStr) {
+		urlStr = fileURL(urlStr)
+	}
+	if u, err := url.Parse(urlStr); err != nil || u.Scheme == "" {
+		return nil, fmt.Errorf("invalid URL %q", urlStr)
+	}
+
+	if expandsIntoTasks(urlStr) {
+		var err error
+		fyne.DoAndWait(func() {
+			err = d.queueDownload(urlStr)
+		})
+		return nil, err
+	}
+
+	task := d.newUserTask(urlStr)
+	if len(urls) > 1 {
+		task.Mirrors = append([]string{urlStr}, urls[1:]...)
+	}
+	if configure != nil {
+		if err := configure(task); err != nil {
+			return nil, err
+		}
+	}
+	fyne.DoAndWait(func() {
+		d.addTask(task)
+	})
+	return task, nil
+}
+
+// changeTaskOptions applies options to a queued or running task. Only the
+// speed limit can change once the download is under way.
+func (d *Downloader) changeTaskOptions(task *DownloadTask, opts map[string]string) *rpcError {
+	if task.Status != "Scheduled" {
+		for key := range opts {
+			if key != "max-download-limit" {
+				delete(opts, key)
+			}
+		}
+	}
+	if limit, ok := opts["max-download-limit"]; ok && task.limiter != nil {
+		rate, err := parseByteSize(limit)
+		if err != nil {
+			return rpcErrorf("%v", err)
+		}
+		task.limiter.setRate(rate)
+		delete(opts, "max-download-limit")
+	}
+	if err := applyTaskOptions(task, opts); err != nil {
+		return rpcErrorf("%v", err)
+	}
+	return nil
+}
+
+func (d *Downloader) changeGlobalOptions(opts map[string]string) *rpcError {
+	// Check every option before applying any
+	rate, dir, split := int64(-1), "", 0
+	for key, value := range opts {
+		switch key {
+		case "max-overall-download-limit":
+			n, err := parseByteSize(value)
+			if err != nil {
+				return rpcErrorf("%v", err)
+			}
+			rate = n
+		case "dir":
+			if !filepath.IsAbs(value) {
+				return rpcErrorf("dir must be an absolute path")
+			}
+			dir = value
+		case "split":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return rpcErrorf("invalid split %q", value)
+			}
+			split = min(n, 50)
+		}
+	}
+
+	if rate >= 0 {
+		// Kept in KB/s like the other limits; any limit at all is at least 1
+		d.setConfig(func(s *appSettings) { s.SpeedLimit = (rate + 1023) / 1024 })
+		d.applySpeedLimit()
+	}
+	fyne.DoAndWait(func() {
+		if dir != "" {
+			d.outputFolder = dir
+		}
+		if split > 0 {
+			d.chunkCount = split
+		}
+		d.saveSettings()
+	})
+	return nil
+}
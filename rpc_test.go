@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyTaskOptionsChecksum(t *testing.T) {
+	tests := []struct {
+		value    string
+		hashType string
+		wantErr  bool
+	}{
+		{value: "sha-256=ABCDEF", hashType: "sha-256"},
+		{value: "sha256=abcdef", hashType: "sha-256"},
+		{value: "SHA1=abcdef", hashType: "sha-1"},
+		{value: "md5=abcdef", hashType: "md5"},
+		{value: "sha-512=abcdef", hashType: "sha-512"},
+		{value: "crc32=abcdef", wantErr: true},
+		{value: "abcdef", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		task := &DownloadTask{}
+		err := applyTaskOptions(task, map[string]string{"checksum": tt.value})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.value, err)
+			continue
+		}
+		if got := task.ExpectedHashes[tt.hashType]; got != "abcdef" || len(task.ExpectedHashes) != 1 {
+			t.Errorf("%q: hashes %v, want %s=abcdef", tt.value, task.ExpectedHashes, tt.hashType)
+		}
+	}
+}
+
+func TestRPCAddURIReturnsGID(t *testing.T) {
+	d := newRemoteTestDownloader(t)
+	call := func(uri string) (any, *rpcError) {
+		params, _ := json.Marshal([]any{[]string{uri}})
+		var list []json.RawMessage
+		json.Unmarshal(params, &list)
+		return d.dispatchRPC("aria2.addUri", list)
+	}
+
+	result, rerr := call("https://example.com/file.iso")
+	if rerr != nil {
+		t.Fatal(rerr.Message)
+	}
+	gid, _ := result.(string)
+	if gid == "" {
+		t.Fatalf("result %v, want a GID", result)
+	}
+	d.mu.Lock()
+	found := false
+	for _, task := range d.tasks {
+		found = found || taskGID(task) == gid
+	}
+	d.mu.Unlock()
+	if !found {
+		t.Errorf("GID %s names no task", gid)
+	}
+
+	for _, uri := range []string{"https://example.com/file.metalink", "https://example.com/files/"} {
+		if result, rerr := call(uri); rerr == nil {
+			t.Errorf("%s: got %v, want an error", uri, result)
+		}
+	}
+	if len(d.tasks) != 1 {
+		t.Errorf("%d tasks, want 1", len(d.tasks))
+	}
+}
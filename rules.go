@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// downloadRule applies options to new downloads whose URL it matches. Every
+// matching rule applies, top to bottom, so later rules override earlier
+// ones.
+type downloadRule struct {
+	// A host glob such as *.example.com, or a regular expression on the
+	// whole URL written between slashes: /\.iso$/
+	Match   string      `json:"match"`
+	Options taskOptions `json:"options"`
+	re      *regexp.Regexp
+}
+
+var (
+	rulesMu       sync.Mutex
+	downloadRules []downloadRule
+)
+
+// compile checks the rule and prepares its pattern.
+func (r *downloadRule) compile() error {
+	r.Match = strings.TrimSpace(r.Match)
+	r.re = nil
+	switch {
+	case r.Match == "":
+		return fmt.Errorf("a rule needs a host or /pattern/ to match")
+	case len(r.Match) > 2 && strings.HasPrefix(r.Match, "/") && strings.HasSuffix(r.Match, "/"):
+		re, err := regexp.Compile(r.Match[1 : len(r.Match)-1])
+		if err != nil {
+			return fmt.Errorf("rule %s: %v", r.Match, err)
+		}
+		r.re = re
+	default:
+		r.Match = strings.ToLower(r.Match)
+		if _, err := path.Match(r.Match, ""); err != nil {
+			return fmt.Errorf("rule %s: %v", r.Match, err)
+		}
+	}
+	if r.Options.Proxy != "" {
+		if _, err := parseProxy(r.Options.Proxy); err != nil {
+			return fmt.Errorf("rule %s: %v", r.Match, err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule covers urlStr. A plain host also
+// matches its www. form.
+func (r *downloadRule) matches(urlStr string) bool {
+	if r.re != nil {
+		return r.re.MatchString(urlStr)
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range []string{host, strings.TrimPrefix(host, "www.")} {
+		if ok, _ := path.Match(r.Match, h); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rulesFor merges the options of every rule matching urlStr.
+func rulesFor(urlStr string) (taskOptions, bool) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	var opts taskOptions
+	found := false
+	for i := range downloadRules {
+		if downloadRules[i].matches(urlStr) {
+			opts = opts.merge(downloadRules[i].Options)
+			found = true
+		}
+	}
+	return opts, found
+}
+
+// newUserTask is newTask with the matching rules applied. Every task a
+// request produces goes through it, including each file of a metalink or
+// folder listing; only the files a site mirror finds while crawling follow
+// their mirror's task instead.
+func (d *Downloader) newUserTask(urlStr string) *DownloadTask {
+	task := d.newTask(urlStr)
+	if opts, ok := rulesFor(urlStr); ok {
+		opts.apply(task)
+	}
+	return task
+}
+
+// domainOf is the host a remembered rule is written for, without a
+// leading "www.".
+func domainOf(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+func hasDomainRule(domain string) bool {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	return domain != "" && slices.ContainsFunc(downloadRules, func(r downloadRule) bool {
+		return r.Match == domain
+	})
+}
+
+// rememberDomain stores opts as the rule for domain.
+func rememberDomain(domain string, opts taskOptions) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	for i, r := range downloadRules {
+		if r.Match == domain {
+			downloadRules[i].Options = opts
+			return
+		}
+	}
+	downloadRules = append(downloadRules, downloadRule{Match: domain, Options: opts})
+}
+
+func currentRules() []downloadRule {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	return slices.Clone(downloadRules)
+}
+
+func setRules(rules []downloadRule) {
+	rulesMu.Lock()
+	downloadRules = rules
+	rulesMu.Unlock()
+}
+
+func (d *Downloader) saveRules() {
+	data, _ := json.Marshal(currentRules())
+	d.app.Preferences().SetString("downloadRules", string(data))
+}
+
+// loadRules reads the rules, including domains remembered from the add
+// dialog, which are stored as rules too.
+func (d *Downloader) loadRules() {
+	var rules []downloadRule
+	json.Unmarshal([]byte(d.app.Preferences().String("downloadRules")), &rules)
+
+	kept := rules[:0]
+	for _, r := range rules {
+		if r.compile() == nil {
+			kept = append(kept, r)
+		}
+	}
+	setRules(kept)
+}
+
+// parseProxy accepts http, https and socks5 proxy URLs.
+func parseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy %q: use http://, https:// or socks5://", proxy)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %q has no host", proxy)
+	}
+	return u, nil
+}
+
+// setProxy routes transport's requests through proxy.
+func setProxy(transport *http.Transport, proxy string) error {
+	u, err := parseProxy(proxy)
+	if err != nil {
+		return err
+	}
+	transport.Proxy = http.ProxyURL(u)
+	return nil
+}
+
+// runPostActions does what the task's rules ask once its file is complete.
+func (d *Downloader) runPostActions(task *DownloadTask) {
+	if task.OpenFolder {
+		fyne.Do(func() {
+			d.openFileLocation(task.OutputFile)
+		})
+	}
+	if task.OnComplete == "" {
+		return
+	}
+
+	args := splitCommand(task.OnComplete)
+	if len(args) == 0 {
+		return
+	}
+	// The path goes last unless the command says where with {file}
+	if !strings.Contains(task.OnComplete, "{file}") {
+		args = append(args, task.OutputFile)
+	}
+	for i := range args {
+		args[i] = strings.ReplaceAll(args[i], "{file}", task.OutputFile)
+	}
+
+	go func() {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = filepath.Dir(task.OutputFile)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			fyne.Do(func() {
+				dialog.ShowError(fmt.Errorf("After-download command for %s failed: %v\n%s",
+					filepath.Base(task.OutputFile), err, strings.TrimSpace(string(out))), d.window)
+			})
+		}
+	}()
+}
+
+// splitCommand splits a command line on spaces, keeping double-quoted
+// parts together. No shell is involved.
+func splitCommand(line string) []string {
+	var args []string
+	var cur strings.Builder
+	inQuote, inArg := false, false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+			inArg = true
+		case (c == ' ' || c == '\t') && !inQuote:
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args
+}
+
+// describeRule sums up what a rule does for the rules list.
+func describeRule(r downloadRule) string {
+	o := r.Options
+	var parts []string
+	if o.Dir != "" {
+		parts = append(parts, "to "+o.Dir)
+	}
+	if o.Chunks > 0 {
+		parts = append(parts, fmt.Sprintf("%d chunks", o.Chunks))
+	}
+	if o.Connections > 0 {
+		parts = append(parts, fmt.Sprintf("%d connections", o.Connections))
+	}
+	if o.SpeedLimit > 0 {
+		parts = append(parts, fmt.Sprintf("%d KB/s", o.SpeedLimit))
+	}
+	if len(o.Headers) > 0 {
+		parts = append(parts, fmt.Sprintf("%d headers", len(o.Headers)))
+	}
+	if o.Proxy != "" {
+		parts = append(parts, "via "+o.Proxy)
+	}
+	if o.Priority != priorityNormal {
+		parts = append(parts, strings.ToLower(priorityNames[min(max(o.Priority, priorityLow), priorityHigh)+1])+" priority")
+	}
+	if o.StartPaused {
+		parts = append(parts, "paused")
+	}
+	if o.OpenFolder {
+		parts = append(parts, "open folder")
+	}
+	if o.Command != "" {
+		parts = append(parts, "run "+o.Command)
+	}
+	if len(parts) == 0 {
+		return "No changes"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// createRulesTab edits a copy of the rules; the settings dialog saves it
+// through the returned function.
+func (d *Downloader) createRulesTab() (fyne.CanvasObject, func() []downloadRule) {
+	rules := currentRules()
+	selected := -1
+
+	list := widget.NewList(
+		func() int { return len(rules) },
+		func() fyne.CanvasObject {
+			match := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+			summary := widget.NewLabel("")
+			summary.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, match, nil, summary)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			row := obj.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(describeRule(rules[id]))
+			row.Objects[1].(*widget.Label).SetText(truncateString(rules[id].Match, 30))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) { selected = id }
+	list.OnUnselected = func(widget.ListItemID) { selected = -1 }
+
+	addBtn := widget.NewButtonWithIcon("Add", theme.ContentAddIcon(), func() {
+		d.showRuleEditor(downloadRule{}, func(r downloadRule) {
+			rules = append(rules, r)
+			list.Refresh()
+		})
+	})
+	editBtn := widget.NewButtonWithIcon("Edit", theme.DocumentCreateIcon(), func() {
+		if selected < 0 {
+			return
+		}
+		i := selected
+		d.showRuleEditor(rules[i], func(r downloadRule) {
+			rules[i] = r
+			list.Refresh()
+		})
+	})
+	removeBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		if selected < 0 {
+			return
+		}
+		rules = slices.Delete(rules, selected, selected+1)
+		list.UnselectAll()
+		list.Refresh()
+	})
+	move := func(delta int) {
+		j := selected + delta
+		if selected < 0 || j < 0 || j >= len(rules) {
+			return
+		}
+		rules[selected], rules[j] = rules[j], rules[selected]
+		list.Select(j)
+		list.Refresh()
+	}
+	upBtn := widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() { move(-1) })
+	downBtn := widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() { move(1) })
+
+	tab := container.NewBorder(
+		widget.NewLabel("Applied to new downloads, top to bottom; later rules win:"),
+		container.NewHBox(addBtn, editBtn, removeBtn, upBtn, downBtn),
+		nil, nil,
+		list,
+	)
+	return tab, func() []downloadRule { return rules }
+}
+
+// showRuleEditor edits r in a dialog and hands the result to done.
+func (d *Downloader) showRuleEditor(r downloadRule, done func(downloadRule)) {
+	matchEntry := widget.NewEntry()
+	matchEntry.SetPlaceHolder("*.example.com or /\\.iso$/")
+	matchEntry.SetText(r.Match)
+
+	f := d.newOptionsForm()
+	f.set(r.Options)
+
+	form := widget.NewForm(widget.NewFormItem("Match", matchEntry))
+	for _, item := range f.items {
+		form.AppendItem(item)
+	}
+
+	content := container.NewVBox(form,
+		container.NewHBox(f.paused, f.openFolder),
+		widget.NewLabel("The command gets the file path as {file}, or as its last argument."),
+	)
+
+	ruleDialog := dialog.NewCustomConfirm("Download Rule", "OK", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		opts, err := f.options()
+		if err != nil {
+			dialog.ShowError(err, d.window)
+			return
+		}
+		rule := downloadRule{Match: matchEntry.Text, Options: opts}
+		if err := rule.compile(); err != nil {
+			dialog.ShowError(err, d.window)
+			return
+		}
+		done(rule)
+	}, d.window)
+
+	ruleDialog.Resize(fyne.NewSize(600, 600))
+	ruleDialog.Show()
+}
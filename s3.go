@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SHA-256 of an empty body, sent with every GET/HEAD we sign.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Settings configures s3:// downloads. Empty fields fall back to the
+// standard AWS_* environment variables.
+type s3Settings struct {
+	Endpoint  string // e.g. http://minio.lab:9000; empty means AWS
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// s3Source reads objects from S3-compatible storage with SigV4-signed
+// ranged GETs. A URL ending in / names a prefix and lists every object
+// under it. It is registered by NewDownloader, whose settings hold the
+// credentials.
+type s3Source struct {
+	d *Downloader
+}
+
+type s3Target struct {
+	endpoint     *url.URL
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	pathStyle    bool
+}
+
+func currentS3Target(cfg s3Settings) (*s3Target, error) {
+	t := &s3Target{
+		region:       firstNonEmpty(cfg.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+		accessKey:    firstNonEmpty(cfg.AccessKey, os.Getenv("AWS_ACCESS_KEY_ID")),
+		secretKey:    firstNonEmpty(cfg.SecretKey, os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	endpoint := firstNonEmpty(cfg.Endpoint, os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"))
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", t.region)
+	} else {
+		// Self-hosted stores like MinIO rarely have wildcard DNS
+		t.pathStyle = true
+	}
+
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %v", err)
+	}
+	t.endpoint = u
+	return t, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// objectURL builds the HTTP URL for bucket/key on the configured endpoint.
+func (t *s3Target) objectURL(bucket, key string, query url.Values) *url.URL {
+	u := *t.endpoint
+	if t.pathStyle {
+		u.Path = "/" + bucket + "/" + key
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = s3Escape(u.Path)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+func (t *s3Target) do(method string, u *url.URL, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	t.sign(req, time.Now())
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConns:    10,
+			IdleConnTimeout: 30 * time.Second,
+		},
+	}
+	return client.Do(req)
+}
+
+// sign adds AWS Signature Version 4 headers. Requests without credentials
+// go out unsigned for public buckets.
+func (t *s3Target) sign(req *http.Request, now time.Time) {
+	if t.accessKey == "" || t.secretKey == "" {
+		return
+	}
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	if t.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", t.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + t.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+t.secretKey), date)
+	key = hmacSHA256(key, t.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape percent-encodes a path the way SigV4 expects: everything but
+// unreserved characters and slashes.
+func s3Escape(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, strings.ReplaceAll(s3Escape(k), "/", "%2F")+"="+
+				strings.ReplaceAll(s3Escape(v), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func splitS3URL(u *url.URL) (string, string, error) {
+	bucket := u.Host
+	if bucket == "" {
+		return "", "", fmt.Errorf("missing bucket in %s", u.String())
+	}
+	return bucket, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+func (s s3Source) stat(u *url.URL) (int64, string, error) {
+	t, err := currentS3Target(s.d.config().S3)
+	if err != nil {
+		return 0, "", err
+	}
+	bucket, key, err := splitS3URL(u)
+	if err != nil {
+		return 0, "", err
+	}
+
+	resp, err := t.do("HEAD", t.objectURL(bucket, key, nil), nil)
+	if err != nil {
+		return 0, "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("S3 returned %s", resp.Status)
+	}
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	return size, path.Base(key), nil
+}
+
+func (s s3Source) openRange(u *url.URL, start, end int64) (io.ReadCloser, error) {
+	t, err := currentS3Target(s.d.config().S3)
+	if err != nil {
+		return nil, err
+	}
+	bucket, key, err := splitS3URL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if end >= 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	} else if start > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+
+	resp, err := t.do("GET", t.objectURL(bucket, key, nil), header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 returned %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list enumerates objects under a prefix with ListObjectsV2. Files keep
+// their path relative to the prefix, inside a folder named after it.
+func (s s3Source) list(u *url.URL) ([]remoteFile, error) {
+	bucket, prefix, err := splitS3URL(u)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		return nil, nil
+	}
+
+	t, err := currentS3Target(s.d.config().S3)
+	if err != nil {
+		return nil, err
+	}
+
+	root := bucket
+	if prefix != "" {
+		root = path.Base(prefix)
+	}
+
+	var files []remoteFile
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := t.do("GET", t.objectURL(bucket, "", query), nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("S3 returned %s", resp.Status)
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid listing: %v", err)
+		}
+
+		for _, obj := range result.Contents {
+			// Zero-byte keys ending in / are folder markers
+			if strings.HasSuffix(obj.Key, "/") {
+				continue
+			}
+			objURL := url.URL{Scheme: "s3", Host: bucket, Path: "/" + obj.Key}
+			files = append(files, remoteFile{
+				URL:     objURL.String(),
+				RelPath: root + "/" + strings.TrimPrefix(obj.Key, prefix),
+				Size:    obj.Size,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	if files == nil {
+		files = []remoteFile{}
+	}
+	return files, nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+)
+
+// How often the scheduler looks at the clock.
+const scheduleTick = 5 * time.Second
+
+// clock lets tests drive the scheduler with a fake time.
+type clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// scheduleWindow is a daily time range on selected weekdays. A range whose
+// end is before its start runs past midnight into the next day.
+type scheduleWindow struct {
+	Days       [7]bool // Indexed by time.Weekday
+	Start, End int     // Minutes since midnight; End may be 24*60
+}
+
+// scheduleSettings limits downloading to time windows. Outside every
+// window new tasks wait and running ones are paused.
+type scheduleSettings struct {
+	Enabled      bool
+	Windows      []scheduleWindow
+	LimitInside  int64 // KB/s, 0 for unlimited
+	LimitOutside int64 // KB/s, 0 for unlimited
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseScheduleWindows reads one window per line, e.g. "Mon-Fri 22:00-06:00"
+// or "daily 01:00-07:00".
+func parseScheduleWindows(text string) ([]scheduleWindow, error) {
+	var windows []scheduleWindow
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%q: expected days and a time range", line)
+		}
+
+		var w scheduleWindow
+		if err := parseWeekdays(fields[0], &w.Days); err != nil {
+			return nil, fmt.Errorf("%q: %v", line, err)
+		}
+
+		from, to, ok := strings.Cut(fields[1], "-")
+		var err error
+		if !ok {
+			return nil, fmt.Errorf("%q: time range must look like 22:00-06:00", line)
+		}
+		if w.Start, err = parseClockTime(from); err != nil {
+			return nil, fmt.Errorf("%q: %v", line, err)
+		}
+		if w.End, err = parseClockTime(to); err != nil {
+			return nil, fmt.Errorf("%q: %v", line, err)
+		}
+		if w.Start == w.End {
+			return nil, fmt.Errorf("%q: window is empty", line)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func parseWeekdays(spec string, days *[7]bool) error {
+	spec = strings.ToLower(spec)
+	if spec == "daily" || spec == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		start, ok := weekdayNames[from]
+		if !ok {
+			return fmt.Errorf("unknown day %q", from)
+		}
+		end := start
+		if isRange {
+			if end, ok = weekdayNames[to]; !ok {
+				return fmt.Errorf("unknown day %q", to)
+			}
+		}
+		// Ranges may wrap, e.g. Fri-Mon
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseClockTime(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	h, err1 := strconv.Atoi(hh)
+	m, err2 := strconv.Atoi(mm)
+	if !ok || err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+func formatScheduleWindows(windows []scheduleWindow) string {
+	names := []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+	var lines []string
+	for _, w := range windows {
+		var days []string
+		// Week starts on Monday
+		for i := 1; i <= 7; i++ {
+			if w.Days[i%7] {
+				days = append(days, names[i%7])
+			}
+		}
+		spec := strings.Join(days, ",")
+		if len(days) == 7 {
+			spec = "daily"
+		}
+		lines = append(lines, fmt.Sprintf("%s %02d:%02d-%02d:%02d",
+			spec, w.Start/60, w.Start%60, w.End/60, w.End%60))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w scheduleWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if w.Start < w.End {
+		return w.Days[day] && minute >= w.Start && minute < w.End
+	}
+	// Overnight: the late part belongs to today, the early part to yesterday
+	yesterday := (day + 6) % 7
+	return (w.Days[day] && minute >= w.Start) || (w.Days[yesterday] && minute < w.End)
+}
+
+// scheduler starts and pauses the queue as windows open and close.
+type scheduler struct {
+	clock clock
+
+	mu       sync.Mutex
+	settings scheduleSettings
+	open     *bool                  // Window state at the last tick; nil forces a refresh
+	paused   map[*DownloadTask]bool // Tasks we paused and should resume
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{clock: systemClock{}, paused: map[*DownloadTask]bool{}}
+}
+
+func (s *scheduler) configure(settings scheduleSettings) {
+	s.mu.Lock()
+	s.settings = settings
+	s.open = nil
+	s.mu.Unlock()
+}
+
+func (s *scheduler) current() scheduleSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings
+}
+
+func (s *scheduler) inWindow(t time.Time) bool {
+	if !s.settings.Enabled {
+		return true
+	}
+	for _, w := range s.settings.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// holding reports whether new tasks should wait for the next window.
+func (s *scheduler) holding() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.inWindow(s.clock.Now())
+}
+
+func (d *Downloader) runScheduler() {
+	ticker := time.NewTicker(scheduleTick)
+	defer ticker.Stop()
+	for {
+		d.scheduleTick()
+		<-ticker.C
+	}
+}
+
+// applySpeedLimit sets the overall limit: the current window's when the
+// schedule gives one, otherwise the one from the settings. It is the only
+// writer of d.limiter.
+func (d *Downloader) applySpeedLimit() {
+	s := d.scheduler
+	s.mu.Lock()
+	limit := int64(0)
+	if s.settings.Enabled && s.open != nil {
+		if *s.open {
+			limit = s.settings.LimitInside
+		} else {
+			limit = s.settings.LimitOutside
+		}
+	}
+	s.mu.Unlock()
+
+	if limit == 0 {
+		limit = d.config().SpeedLimit
+	}
+	d.limiter.setRate(limit * 1024)
+}
+
+// scheduleTick applies the current window: when it opens, waiting tasks
+// start and tasks we paused resume; when it closes, active tasks pause.
+func (d *Downloader) scheduleTick() {
+	s := d.scheduler
+	s.mu.Lock()
+	open := s.inWindow(s.clock.Now())
+	changed := s.open == nil || *s.open != open
+	s.open = &open
+	s.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	d.applySpeedLimit()
+
+	// Higher priorities start first, then in the order they were added
+	tasks := d.taskSnapshot()
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].Priority > tasks[j].Priority
+	})
+
+	for _, task := range tasks {
+		switch {
+		case open && task.Status == "Scheduled":
+			task.Status = "Preparing..."
+			fyne.Do(func() {
+				task.updateStatusDisplay()
+				task.speedLabel.SetText("-- MB/s")
+			})
+			go d.startDownload(task)
+
+		case open && task.Status == "Paused" && s.takePaused(task):
+			task.Status = "Downloading"
+			fyne.Do(func() {
+				task.updateStatusDisplay()
+				task.actionButton.SetIcon(theme.MediaPauseIcon())
+			})
+
+		case !open && task.Status == "Downloading":
+			task.Status = "Paused"
+			s.mu.Lock()
+			s.paused[task] = true
+			s.mu.Unlock()
+			fyne.Do(func() {
+				task.updateStatusDisplay()
+				task.actionButton.SetIcon(theme.MediaPlayIcon())
+			})
+		}
+	}
+	d.updateStats()
+}
+
+func (s *scheduler) takePaused(task *DownloadTask) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.paused[task] {
+		return false
+	}
+	delete(s.paused, task)
+	return true
+}
+
+// rateLimiter caps combined download speed across all tasks.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int64     // Bytes per second; 0 is unlimited
+	next time.Time // When the bytes handed out so far have been paid for
+}
+
+func (l *rateLimiter) setRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	l.rate = bytesPerSecond
+	l.next = time.Time{}
+	l.mu.Unlock()
+}
+
+// wait blocks long enough to keep n more bytes under the rate.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// throttle is called after each read and applies the task's and the
+// global bandwidth caps.
+func (d *Downloader) throttle(task *DownloadTask, n int) {
+	if task.limiter != nil {
+		task.limiter.wait(n)
+	}
+	d.limiter.wait(priorityCost(task.Priority, n))
+}
+
+// waitResume blocks while a task is paused and reports whether it should
+// go on; readers close their connection before waiting and reopen it from
+// where they stopped.
+func waitResume(task *DownloadTask) bool {
+	for task.Status == "Paused" {
+		time.Sleep(200 * time.Millisecond)
+	}
+	return task.Status != "Cancelled"
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/test"
+	"fyne.io/fyne/v2/widget"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// January 2024 starts on a Monday.
+func at(day, hour, minute int) time.Time {
+	return time.Date(2024, time.January, day, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseScheduleWindows(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    []scheduleWindow
+		wantErr bool
+	}{
+		{text: "", want: nil},
+		{text: "# comment\n\n", want: nil},
+		{
+			text: "daily 01:00-07:00",
+			want: []scheduleWindow{{Days: [7]bool{true, true, true, true, true, true, true}, Start: 60, End: 420}},
+		},
+		{
+			text: "Mon-Fri 22:00-06:00",
+			want: []scheduleWindow{{Days: [7]bool{false, true, true, true, true, true, false}, Start: 1320, End: 360}},
+		},
+		{
+			text: "fri-mon 00:00-24:00",
+			want: []scheduleWindow{{Days: [7]bool{true, true, false, false, false, true, true}, Start: 0, End: 1440}},
+		},
+		{
+			text: "Sat,Sun 09:30-12:00\nWed 18:00-19:00",
+			want: []scheduleWindow{
+				{Days: [7]bool{true, false, false, false, false, false, true}, Start: 570, End: 720},
+				{Days: [7]bool{false, false, false, true, false, false, false}, Start: 1080, End: 1140},
+			},
+		},
+		{text: "Mon", wantErr: true},
+		{text: "Funday 01:00-02:00", wantErr: true},
+		{text: "Mon 01:00", wantErr: true},
+		{text: "Mon 25:00-26:00", wantErr: true},
+		{text: "Mon 01:60-02:00", wantErr: true},
+		{text: "Mon 03:00-03:00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseScheduleWindows(tt.text)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %d windows, want %d", tt.text, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: window %d = %+v, want %+v", tt.text, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestScheduleWindowRoundTrip(t *testing.T) {
+	text := "Mon,Tue,Wed,Thu,Fri 22:00-06:00\ndaily 12:00-13:00\nSat,Sun 00:00-24:00"
+	windows, err := parseScheduleWindows(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatScheduleWindows(windows); got != text {
+		t.Errorf("formatted as %q, want %q", got, text)
+	}
+}
+
+func TestScheduleWindowContains(t *testing.T) {
+	weeknights, err := parseScheduleWindows("Mon-Fri 22:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lunch, err := parseScheduleWindows("daily 12:00-13:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekend, err := parseScheduleWindows("Sat-Sun 00:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		window scheduleWindow
+		t      time.Time
+		want   bool
+	}{
+		{"monday evening start", weeknights[0], at(1, 22, 0), true},
+		{"monday before start", weeknights[0], at(1, 21, 59), false},
+		{"tuesday early, from monday", weeknights[0], at(2, 5, 59), true},
+		{"tuesday at end", weeknights[0], at(2, 6, 0), false},
+		{"monday early, sunday not selected", weeknights[0], at(1, 3, 0), false},
+		{"friday late", weeknights[0], at(5, 23, 30), true},
+		{"saturday early, from friday", weeknights[0], at(6, 2, 0), true},
+		{"saturday late", weeknights[0], at(6, 23, 0), false},
+		{"sunday early", weeknights[0], at(7, 2, 0), false},
+		{"lunch start", lunch[0], at(3, 12, 0), true},
+		{"lunch end", lunch[0], at(3, 13, 0), false},
+		{"weekend midnight", weekend[0], at(6, 0, 0), true},
+		{"weekend last minute", weekend[0], at(7, 23, 59), true},
+		{"monday after weekend", weekend[0], at(8, 0, 0), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.window.contains(tt.t); got != tt.want {
+			t.Errorf("%s (%s): got %v, want %v", tt.name, tt.t.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+func newScheduledTask(status string) *DownloadTask {
+	return &DownloadTask{
+		Status:       status,
+		statusLabel:  widget.NewLabel(""),
+		speedLabel:   widget.NewLabel(""),
+		actionButton: widget.NewButton("", nil),
+	}
+}
+
+func TestScheduleTick(t *testing.T) {
+	test.NewApp()
+
+	windows, err := parseScheduleWindows("daily 22:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: at(1, 23, 0)}
+	d := &Downloader{
+		tasks:      map[string]*DownloadTask{},
+		statsLabel: widget.NewLabel(""),
+		scheduler:  newScheduler(),
+		limiter:    &rateLimiter{},
+	}
+	d.scheduler.clock = clock
+	d.scheduler.configure(scheduleSettings{
+		Enabled:      true,
+		Windows:      windows,
+		LimitInside:  500,
+		LimitOutside: 50,
+	})
+
+	running := newScheduledTask("Downloading")
+	userPaused := newScheduledTask("Paused")
+	d.tasks["running"] = running
+	d.tasks["paused"] = userPaused
+
+	rate := func() int64 {
+		d.limiter.mu.Lock()
+		defer d.limiter.mu.Unlock()
+		return d.limiter.rate
+	}
+
+	steps := []struct {
+		name       string
+		now        time.Time
+		holding    bool
+		running    string
+		userPaused string
+		rate       int64
+	}{
+		{"inside the window", at(1, 23, 0), false, "Downloading", "Paused", 500 * 1024},
+		{"past midnight", at(2, 5, 59), false, "Downloading", "Paused", 500 * 1024},
+		{"window closes", at(2, 6, 0), true, "Paused", "Paused", 50 * 1024},
+		{"still closed", at(2, 12, 0), true, "Paused", "Paused", 50 * 1024},
+		{"window opens", at(2, 22, 0), false, "Downloading", "Paused", 500 * 1024},
+	}
+
+	for _, step := range steps {
+		clock.now = step.now
+		d.scheduleTick()
+		if got := d.scheduler.holding(); got != step.holding {
+			t.Errorf("%s: holding = %v, want %v", step.name, got, step.holding)
+		}
+		if running.Status != step.running {
+			t.Errorf("%s: scheduled task is %q, want %q", step.name, running.Status, step.running)
+		}
+		if userPaused.Status != step.userPaused {
+			t.Errorf("%s: task paused by the user is %q, want %q", step.name, userPaused.Status, step.userPaused)
+		}
+		if got := rate(); got != step.rate {
+			t.Errorf("%s: rate = %d, want %d", step.name, got, step.rate)
+		}
+	}
+
+	// Turning the schedule off lifts the limit and the hold
+	d.scheduler.configure(scheduleSettings{})
+	clock.now = at(3, 12, 0)
+	d.scheduleTick()
+	if d.scheduler.holding() || rate() != 0 {
+		t.Errorf("disabled schedule still holds or limits: holding %v, rate %d", d.scheduler.holding(), rate())
+	}
+}
+
+func TestOverallSpeedLimit(t *testing.T) {
+	app := test.NewApp()
+	clock := &fakeClock{now: at(1, 12, 0)}
+	d := &Downloader{
+		app:        app,
+		tasks:      map[string]*DownloadTask{},
+		statsLabel: widget.NewLabel(""),
+		scheduler:  newScheduler(),
+		limiter:    &rateLimiter{},
+		settings:   appSettings{SpeedLimit: 200},
+	}
+	d.scheduler.clock = clock
+	rate := func() int64 {
+		d.limiter.mu.Lock()
+		defer d.limiter.mu.Unlock()
+		return d.limiter.rate
+	}
+
+	d.scheduleTick()
+	if got := rate(); got != 200*1024 {
+		t.Errorf("without a schedule: rate = %d, want the overall %d", got, 200*1024)
+	}
+
+	// A window without a limit of its own falls back to the overall one
+	windows, err := parseScheduleWindows("daily 10:00-14:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.scheduler.configure(scheduleSettings{Enabled: true, Windows: windows, LimitOutside: 50})
+	d.scheduleTick()
+	if got := rate(); got != 200*1024 {
+		t.Errorf("inside a window with no limit: rate = %d, want %d", got, 200*1024)
+	}
+	clock.now = at(1, 15, 0)
+	d.scheduleTick()
+	if got := rate(); got != 50*1024 {
+		t.Errorf("outside the window: rate = %d, want %d", got, 50*1024)
+	}
+
+	// Set over RPC, then kept when the schedule is saved again
+	if err := d.changeGlobalOptions(map[string]string{"max-overall-download-limit": "1M"}); err != nil {
+		t.Fatal(err.Message)
+	}
+	if got := d.config().SpeedLimit; got != 1024 {
+		t.Errorf("overall limit %d KB/s, want 1024", got)
+	}
+	if got := app.Preferences().Int("speedLimit"); got != 1024 {
+		t.Errorf("saved overall limit %d, want 1024", got)
+	}
+	d.scheduler.configure(scheduleSettings{})
+	d.scheduleTick()
+	if got := rate(); got != 1024*1024 {
+		t.Errorf("after saving the schedule: rate = %d, want %d", got, 1024*1024)
+	}
+}
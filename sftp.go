@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// How long an unused SSH connection is kept for the next chunk.
+const sshIdleTimeout = 30 * time.Second
+
+// sftpSource reads files over SFTP. All chunks of a file share one SSH
+// connection and issue their reads concurrently on it. It is registered by
+// NewDownloader, whose settings name an extra key file.
+type sftpSource struct {
+	d *Downloader
+}
+
+func (s sftpSource) stat(u *url.URL) (int64, string, error) {
+	conn, err := acquireSFTP(u, s.d.config().SSHKeyFile)
+	if err != nil {
+		return 0, "", err
+	}
+	defer conn.release()
+
+	info, err := conn.client.Stat(sftpPath(u))
+	if err != nil {
+		conn.evict()
+		return 0, "", err
+	}
+	if info.IsDir() {
+		return 0, "", fmt.Errorf("%s is a directory", u.Path)
+	}
+	return info.Size(), path.Base(u.Path), nil
+}
+
+func (s sftpSource) openRange(u *url.URL, start, end int64) (io.ReadCloser, error) {
+	conn, err := acquireSFTP(u, s.d.config().SSHKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := conn.client.Open(sftpPath(u))
+	if err != nil {
+		conn.evict()
+		conn.release()
+		return nil, err
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		file.Close()
+		conn.evict()
+		conn.release()
+		return nil, err
+	}
+
+	return newRangeReader(file, start, end, func() error {
+		err := file.Close()
+		conn.release()
+		return err
+	}), nil
+}
+
+// sftpPath maps the URL path to a remote path. Paths are absolute except
+// /~/ which is relative to the login directory.
+func sftpPath(u *url.URL) string {
+	if rest, ok := strings.CutPrefix(u.Path, "/~/"); ok {
+		return rest
+	}
+	return u.Path
+}
+
+type sftpConn struct {
+	key    string
+	ssh    *ssh.Client
+	client *sftp.Client
+	refs   int
+	idle   *time.Timer
+	broken bool // No longer handed out; closed when the last user releases it
+}
+
+// sftpDial is a connection being set up, which other chunks for the same
+// host wait for rather than dialing their own.
+type sftpDial struct {
+	done chan struct{}
+	err  error
+}
+
+var (
+	sftpMu    sync.Mutex
+	sftpConns = map[string]*sftpConn{}
+	sftpDials = map[string]*sftpDial{}
+)
+
+// acquireSFTP returns a shared connection for the URL's user and host,
+// dialing one if needed with keyFile offered besides the usual keys.
+// Callers must release it.
+func acquireSFTP(u *url.URL, keyFile string) (*sftpConn, error) {
+	user := ""
+	if u.User != nil {
+		user = u.User.Username()
+	}
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+	key := user + "@" + host
+
+	for {
+		sftpMu.Lock()
+		if conn := sftpConns[key]; conn != nil {
+			if conn.idle != nil {
+				conn.idle.Stop()
+				conn.idle = nil
+			}
+			conn.refs++
+			sftpMu.Unlock()
+			return conn, nil
+		}
+		if pending := sftpDials[key]; pending != nil {
+			sftpMu.Unlock()
+			<-pending.done
+			if pending.err != nil {
+				return nil, pending.err
+			}
+			continue
+		}
+		pending := &sftpDial{done: make(chan struct{})}
+		sftpDials[key] = pending
+		sftpMu.Unlock()
+
+		// The handshake can take seconds, so it runs without the lock
+		conn, err := dialSFTP(u, user, host, keyFile)
+
+		sftpMu.Lock()
+		delete(sftpDials, key)
+		pending.err = err
+		if err == nil {
+			conn.key = key
+			conn.refs = 1
+			sftpConns[key] = conn
+		}
+		sftpMu.Unlock()
+		close(pending.done)
+
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			// Stop sharing a connection the server has dropped
+			conn.ssh.Wait()
+			conn.evict()
+		}()
+		return conn, nil
+	}
+}
+
+func dialSFTP(u *url.URL, user, host, keyFile string) (*sftpConn, error) {
+	config, closeAgent, err := sshClientConfig(u, user, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	sshClient, err := ssh.Dial("tcp", host, config)
+	closeAgent()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(sshClient,
+		sftp.UseConcurrentReads(true),
+		sftp.MaxConcurrentRequestsPerFile(64))
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+	return &sftpConn{ssh: sshClient, client: client}, nil
+}
+
+func (c *sftpConn) release() {
+	sftpMu.Lock()
+	defer sftpMu.Unlock()
+
+	c.refs--
+	if c.refs > 0 {
+		return
+	}
+	if c.broken {
+		c.close()
+		return
+	}
+	c.idle = time.AfterFunc(sshIdleTimeout, func() {
+		sftpMu.Lock()
+		defer sftpMu.Unlock()
+		if c.refs > 0 || c.broken {
+			return
+		}
+		c.broken = true
+		delete(sftpConns, c.key)
+		c.close()
+	})
+}
+
+// evict stops handing out a connection after an error so the next chunk
+// dials afresh. Chunks still using it keep it until they release it.
+func (c *sftpConn) evict() {
+	sftpMu.Lock()
+	defer sftpMu.Unlock()
+
+	if c.broken {
+		return
+	}
+	c.broken = true
+	if sftpConns[c.key] == c {
+		delete(sftpConns, c.key)
+	}
+	if c.refs == 0 {
+		if c.idle != nil {
+			c.idle.Stop()
+		}
+		c.close()
+	}
+}
+
+// close drops the SSH transport first, which also ends the SFTP session
+// without waiting on the server.
+func (c *sftpConn) close() {
+	c.ssh.Close()
+	c.client.Close()
+}
+
+// sshClientConfig offers the URL password, the SSH agent, keyFile and the
+// usual key files, and checks the host against ~/.ssh/known_hosts. The agent signs
+// during the handshake, so closeAgent must only be called once it is over.
+func sshClientConfig(u *url.URL, user, keyFile string) (config *ssh.ClientConfig, closeAgent func(), err error) {
+	homeDir, _ := os.UserHomeDir()
+
+	hostKeyCallback, err := knownhosts.New(filepath.Join(homeDir, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot verify host keys: %v", err)
+	}
+
+	var signers []ssh.Signer
+	closeAgent = func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if agentConn, err := net.Dial("unix", sock); err == nil {
+			closeAgent = func() { agentConn.Close() }
+			if agentSigners, err := agent.NewClient(agentConn).Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+
+	keyFiles := []string{keyFile}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		keyFiles = append(keyFiles, filepath.Join(homeDir, ".ssh", name))
+	}
+	for _, name := range keyFiles {
+		if name == "" {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		// Passphrase-protected keys are expected to come from the agent
+		if signer, err := ssh.ParsePrivateKey(data); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+
+	var auth []ssh.AuthMethod
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			auth = append(auth, ssh.Password(password))
+			auth = append(auth, ssh.KeyboardInteractive(
+				func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+					answers := make([]string, len(questions))
+					for i := range answers {
+						answers[i] = password
+					}
+					return answers, nil
+				}))
+		}
+	}
+	if len(auth) == 0 {
+		closeAgent()
+		return nil, nil, fmt.Errorf("no SSH key or password available for %s", u.Host)
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}, closeAgent, nil
+}
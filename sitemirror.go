@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	// Stop crawling after this many URLs.
+	maxMirrorURLs = 5000
+	// Files downloaded at once by a mirror.
+	mirrorWorkers = 4
+	// Files below this size are fetched as a single chunk.
+	mirrorSmallFile = 1024 * 1024
+)
+
+// Crawl scopes, as offered in the mirror dialog.
+var mirrorScopes = []string{"Same host", "Same domain", "Any host"}
+
+// siteMirror describes a recursive crawl. It is set on the parent task,
+// whose children are the files found.
+type siteMirror struct {
+	Start       *url.URL
+	Depth       int
+	Scope       string
+	BelowStart  bool // Never go above the start URL's folder
+	Include     *regexp.Regexp
+	Exclude     *regexp.Regexp
+	Robots      bool
+	SkipCurrent bool
+
+	robots map[string]*robotsRules
+}
+
+// robotsRules holds the Allow/Disallow prefixes for User-agent: *.
+type robotsRules struct {
+	allow    []string
+	disallow []string
+}
+
+func (m *siteMirror) startDir() string {
+	dir := m.Start.Path
+	return dir[:strings.LastIndex(dir, "/")+1]
+}
+
+// inScope applies the domain scope, folder limit, exclude pattern and
+// robots.txt. URLs with a query string are skipped, like the sort links on
+// autoindex pages.
+func (m *siteMirror) inScope(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" || u.RawQuery != "" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	startHost := strings.ToLower(m.Start.Hostname())
+	switch m.Scope {
+	case "Same host":
+		if host != startHost {
+			return false
+		}
+	case "Same domain":
+		domain := strings.TrimPrefix(startHost, "www.")
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			return false
+		}
+	}
+
+	if m.BelowStart && host == startHost && !strings.HasPrefix(u.Path, m.startDir()) {
+		return false
+	}
+	if m.Exclude != nil && m.Exclude.MatchString(u.String()) {
+		return false
+	}
+	if m.Robots && !m.robotsFor(u).allowed(u.EscapedPath()) {
+		return false
+	}
+	return true
+}
+
+func (m *siteMirror) robotsFor(u *url.URL) *robotsRules {
+	key := u.Scheme + "://" + u.Host
+	if rules, ok := m.robots[key]; ok {
+		return rules
+	}
+	rules := fetchRobots(key + "/robots.txt")
+	m.robots[key] = rules
+	return rules
+}
+
+// fetchRobots loads robots.txt. A missing or unreadable file allows
+// everything.
+func fetchRobots(robotsURL string) *robotsRules {
+	rules := &robotsRules{}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	req, err := http.NewRequest("GET", robotsURL, nil)
+	if err != nil {
+		return rules
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	resp, err := client.Do(req)
+	if err != nil {
+		return rules
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rules
+	}
+
+	applies := false
+	inAgents := false
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 512*1024))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive User-agent lines share one group
+			if !inAgents {
+				applies = false
+			}
+			inAgents = true
+			if value == "*" {
+				applies = true
+			}
+		case "allow", "disallow":
+			inAgents = false
+			if !applies || value == "" {
+				continue
+			}
+			value = strings.TrimSuffix(value, "*")
+			if key == "allow" {
+				rules.allow = append(rules.allow, value)
+			} else {
+				rules.disallow = append(rules.disallow, value)
+			}
+		default:
+			inAgents = false
+		}
+	}
+	return rules
+}
+
+// allowed applies the longest matching rule; Allow wins ties.
+func (r *robotsRules) allowed(p string) bool {
+	longest := func(prefixes []string) int {
+		n := -1
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(p, prefix) && len(prefix) > n {
+				n = len(prefix)
+			}
+		}
+		return n
+	}
+	return longest(r.allow) >= longest(r.disallow)
+}
+
+// mirrorPath maps a URL to host/path under the output folder. Folder URLs
+// are saved as index.html.
+func mirrorPath(outputFolder string, u *url.URL) (string, error) {
+	p := u.Path
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += "index.html"
+	}
+	host := strings.ReplaceAll(u.Host, ":", "_")
+	rel, err := safeRelativePath(host + p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(outputFolder, filepath.FromSlash(rel)), nil
+}
+
+// upToDate reports whether a local copy matches the remote size and is no
+// older than its Last-Modified date.
+func upToDate(localPath string, size int64, lastModified string) bool {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return false
+	}
+	if size > 0 && info.Size() != size {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err == nil && info.ModTime().Before(modified) {
+		return false
+	}
+	return size > 0 || err == nil
+}
+
+func isHTMLResponse(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// runSiteMirror crawls breadth-first from the start URL. Pages are saved
+// as they are parsed; every other file becomes a child task downloaded by a
+// small worker pool.
+func (d *Downloader) runSiteMirror(task *DownloadTask) {
+	m := task.site
+	outputFolder := d.taskFolder(task)
+	task.Status = "Crawling"
+	fyne.Do(func() {
+		task.fileNameLabel.SetText("Mirror: " + m.Start.Host + m.Start.Path)
+		task.updateStatusDisplay()
+	})
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	if task.Proxy != "" {
+		transport := &http.Transport{}
+		if err := setProxy(transport, task.Proxy); err != nil {
+			d.failDownload(task, err)
+			return
+		}
+		client.Transport = transport
+	}
+
+	files := make(chan *DownloadTask, maxMirrorURLs)
+	var workers sync.WaitGroup
+	for i := 0; i < mirrorWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for child := range files {
+				// Queued files wait while the mirror is paused
+				if waitResume(task) && child.Status != "Cancelled" {
+					d.startDownload(child)
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go d.monitorSiteMirror(task, done)
+
+	pages, queued, skipped := 0, 0, 0
+
+	type pending struct {
+		u     *url.URL
+		depth int
+	}
+	queue := []pending{{m.Start, 0}}
+	seen := map[string]bool{m.Start.String(): true}
+
+	for len(queue) > 0 && waitResume(task) {
+		item := queue[0]
+		queue = queue[1:]
+
+		// Files only need their headers; pages, and servers that refuse
+		// HEAD, are fetched with GET
+		resp, err := mirrorRequest(client, http.MethodHead, item.u, task.Headers)
+		if err != nil || resp.StatusCode != http.StatusOK || isHTMLResponse(resp) {
+			if err == nil {
+				resp.Body.Close()
+			}
+			if resp, err = mirrorRequest(client, http.MethodGet, item.u, task.Headers); err != nil {
+				continue
+			}
+		}
+		final := resp.Request.URL
+		if resp.StatusCode != http.StatusOK || (final.String() != item.u.String() && !m.inScope(final)) {
+			resp.Body.Close()
+			continue
+		}
+
+		localPath, err := mirrorPath(outputFolder, final)
+		if err != nil {
+			resp.Body.Close()
+			continue
+		}
+
+		if !isHTMLResponse(resp) {
+			// The child task fetches the body; only the headers were needed
+			resp.Body.Close()
+			if m.Include != nil && !m.Include.MatchString(final.String()) {
+				continue
+			}
+			if m.SkipCurrent && upToDate(localPath, resp.ContentLength, resp.Header.Get("Last-Modified")) {
+				skipped++
+				continue
+			}
+
+			// Files follow the mirror's rules rather than their own
+			child := d.newTask(final.String())
+			child.Headers = task.Headers
+			child.Proxy = task.Proxy
+			child.OutputFile = localPath
+			child.TotalSize = resp.ContentLength
+			child.infoKnown = true
+			child.Status = "Queued"
+			if child.TotalSize < mirrorSmallFile {
+				child.ChunkCount = 1
+			}
+			child.parent = task
+			fyne.Do(func() {
+				d.addChildTask(task, child)
+			})
+			files <- child
+			queued++
+			continue
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+		resp.Body.Close()
+		if err != nil {
+			continue
+		}
+		pages++
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err == nil {
+			os.WriteFile(localPath, body, 0644)
+		}
+
+		if item.depth >= m.Depth {
+			continue
+		}
+		for _, link := range extractLinks(final, bytes.NewReader(body)) {
+			u, err := url.Parse(link.URL)
+			if err != nil || seen[u.String()] || len(seen) >= maxMirrorURLs || !m.inScope(u) {
+				continue
+			}
+			seen[u.String()] = true
+			queue = append(queue, pending{u, item.depth + 1})
+		}
+
+		status := fmt.Sprintf("%d pages | %d files | %d up to date", pages, queued, skipped)
+		fyne.Do(func() {
+			task.speedLabel.SetText(status)
+		})
+	}
+
+	close(files)
+	if task.Status != "Cancelled" {
+		task.Status = "Downloading"
+	}
+	workers.Wait()
+	close(done)
+
+	if task.Status == "Cancelled" {
+		return
+	}
+
+	failed := 0
+	task.mu.Lock()
+	children := task.children
+	task.mu.Unlock()
+	for _, child := range children {
+		if child.Status == "Failed" {
+			failed++
+		}
+	}
+
+	task.Status = "Completed"
+	summary := fmt.Sprintf("%d pages | %d files | %d up to date", pages, len(children), skipped)
+	if failed > 0 {
+		task.Status = "Failed"
+		summary += fmt.Sprintf(" | %d failed", failed)
+	}
+	fyne.Do(func() {
+		task.progressBar.SetValue(1.0)
+		task.speedLabel.SetText(summary)
+		task.updateStatusDisplay()
+		task.actionButton.SetIcon(theme.FolderOpenIcon())
+		task.actionButton.OnTapped = func() {
+			d.openFileLocation(filepath.Join(outputFolder, m.Start.Host, "index.html"))
+		}
+	})
+	d.updateStats()
+}
+
+// mirrorRequest sends one crawl request with the mirror's extra headers.
+func mirrorRequest(client *http.Client, method string, u *url.URL, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	setHeaders(req, header)
+	return client.Do(req)
+}
+
+// monitorSiteMirror shows overall progress across the child tasks.
+func (d *Downloader) monitorSiteMirror(task *DownloadTask, done chan struct{}) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		task.mu.Lock()
+		children := task.children
+		task.mu.Unlock()
+
+		finished := 0
+		for _, child := range children {
+			if child.Status == "Completed" || child.Status == "Failed" {
+				finished++
+			}
+		}
+		if len(children) == 0 {
+			continue
+		}
+
+		progress := float64(finished) / float64(len(children))
+		fyne.Do(func() {
+			task.progressBar.SetValue(progress)
+			task.updateStatusDisplay()
+		})
+	}
+}
+
+// addChildTask shows a mirror's file under its parent. Must be called on
+// the UI thread; the mirror's workers start it.
+func (d *Downloader) addChildTask(parent, child *DownloadTask) {
+	child.createTaskUI(d)
+	child.fileNameLabel.SetText(filepath.Base(child.OutputFile))
+	child.updateStatusDisplay()
+
+	d.mu.Lock()
+	d.tasks[child.ID] = child
+	d.mu.Unlock()
+
+	parent.mu.Lock()
+	parent.children = append(parent.children, child)
+	parent.mu.Unlock()
+
+	parent.childList.Add(child.container)
+	d.updateStats()
+}
+
+func (d *Downloader) showSiteMirror() {
+	startEntry := widget.NewEntry()
+	startEntry.SetPlaceHolder("https://example.com/docs/")
+	if strings.HasPrefix(d.urlEntry.Text, "http") {
+		startEntry.SetText(strings.TrimSpace(d.urlEntry.Text))
+	}
+
+	depthEntry := widget.NewEntry()
+	depthEntry.SetText("3")
+
+	scopeSelect := widget.NewSelect(mirrorScopes, nil)
+	scopeSelect.SetSelected(mirrorScopes[0])
+
+	includeEntry := widget.NewEntry()
+	includeEntry.SetPlaceHolder(`Regex files must match, e.g. \.(pdf|zip)$`)
+	excludeEntry := widget.NewEntry()
+	excludeEntry.SetPlaceHolder("Regex for URLs to skip")
+
+	belowCheck := widget.NewCheck("Stay below the start folder", nil)
+	belowCheck.SetChecked(true)
+	robotsCheck := widget.NewCheck("Respect robots.txt", nil)
+	robotsCheck.SetChecked(true)
+	skipCheck := widget.NewCheck("Skip files that are already up to date", nil)
+	skipCheck.SetChecked(true)
+
+	form := widget.NewForm(
+		widget.NewFormItem("Start URL", startEntry),
+		widget.NewFormItem("Depth", depthEntry),
+		widget.NewFormItem("Scope", scopeSelect),
+		widget.NewFormItem("Include", includeEntry),
+		widget.NewFormItem("Exclude", excludeEntry),
+	)
+	content := container.NewVBox(form, belowCheck, robotsCheck, skipCheck)
+
+	mirrorDialog := dialog.NewCustomConfirm("Mirror Site", "Start", "Cancel", content, func(start bool) {
+		if !start {
+			return
+		}
+
+		m, err := parseSiteMirror(startEntry.Text, depthEntry.Text, includeEntry.Text, excludeEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, d.window)
+			return
+		}
+		m.Scope = scopeSelect.Selected
+		m.BelowStart = belowCheck.Checked
+		m.Robots = robotsCheck.Checked
+		m.SkipCurrent = skipCheck.Checked
+
+		task := d.newUserTask(m.Start.String())
+		task.site = m
+		d.addTask(task)
+	}, d.window)
+
+	mirrorDialog.Resize(fyne.NewSize(550, 400))
+	mirrorDialog.Show()
+}
+
+func parseSiteMirror(start, depth, include, exclude string) (*siteMirror, error) {
+	u, err := url.Parse(strings.TrimSpace(start))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("Start URL must be an http(s) URL")
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	m := &siteMirror{Start: u, robots: map[string]*robotsRules{}}
+	if m.Depth, err = strconv.Atoi(strings.TrimSpace(depth)); err != nil || m.Depth < 0 {
+		return nil, fmt.Errorf("Depth must be a whole number")
+	}
+	if include = strings.TrimSpace(include); include != "" {
+		if m.Include, err = regexp.Compile(include); err != nil {
+			return nil, fmt.Errorf("Invalid include pattern: %v", err)
+		}
+	}
+	if exclude = strings.TrimSpace(exclude); exclude != "" {
+		if m.Exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("Invalid exclude pattern: %v", err)
+		}
+	}
+	return m, nil
+}
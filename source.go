@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// rangeSource is a non-HTTP protocol that plugs into the chunk pipeline.
+// HTTP(S) stays on the built-in code path.
+type rangeSource interface {
+	// stat returns the remote size (0 if unknown) and a suggested file name.
+	stat(u *url.URL) (int64, string, error)
+	// openRange streams bytes start-end inclusive, or to EOF when end < 0.
+	openRange(u *url.URL, start, end int64) (io.ReadCloser, error)
+}
+
+// sources maps URL schemes to their backends. Backends register themselves
+// from init, or from NewDownloader when they read its settings.
+var sources = map[string]rangeSource{}
+
+// directorySource is implemented by backends whose URLs can name a folder
+// or prefix rather than a single file.
+type directorySource interface {
+	// list returns the files below u, or nil if u names a single file.
+	list(u *url.URL) ([]remoteFile, error)
+}
+
+type remoteFile struct {
+	URL     string
+	RelPath string // Slash-separated path to recreate under the output folder
+	Size    int64
+}
+
+func sourceFor(urlStr string) rangeSource {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil
+	}
+	return sources[strings.ToLower(u.Scheme)]
+}
+
+// openRange opens bytes start-end of urlStr with whichever backend handles
+// its scheme.
+func openRange(urlStr string, start, end int64) (io.ReadCloser, error) {
+	src := sourceFor(urlStr)
+	if src == nil {
+		return openHTTPRange(urlStr, start, end, nil, "")
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	return src.openRange(u, start, end)
+}
+
+// openTaskRange is openRange with the task's extra request headers and
+// proxy, which only plain HTTP uses.
+func openTaskRange(task *DownloadTask, urlStr string, start, end int64) (io.ReadCloser, error) {
+	if sourceFor(urlStr) == nil {
+		return openHTTPRange(urlStr, start, end, task.Headers, task.Proxy)
+	}
+	return openRange(urlStr, start, end)
+}
+
+func (d *Downloader) getSourceFileInfo(task *DownloadTask, src rangeSource) error {
+	u, err := url.Parse(task.URL)
+	if err != nil {
+		return err
+	}
+
+	size, name, err := src.stat(u)
+	if err != nil {
+		return err
+	}
+	task.TotalSize = size
+
+	if name == "" {
+		name = path.Base(u.Path)
+	}
+	if name == "" || name == "/" || name == "." {
+		name = "download_" + task.ID
+	}
+	if task.FileName != "" {
+		name = task.FileName
+	}
+	folder := d.taskFolder(task)
+	task.OutputFile = filepath.Join(folder, filepath.Base(name))
+
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return fmt.Errorf("failed to create output folder: %v", err)
+	}
+	return nil
+}
+
+// queueListing expands a folder URL into one task per file, keeping the
+// remote layout under the output folder. A URL naming a single file is
+// queued as is. Runs in the background since listing touches the network.
+func (d *Downloader) queueListing(urlStr string, lister directorySource) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return
+	}
+
+	files, err := lister.list(u)
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("Failed to list %s: %v", urlStr, err), d.window)
+		})
+		return
+	}
+
+	if files == nil {
+		task := d.newUserTask(urlStr)
+		fyne.Do(func() {
+			d.addTask(task)
+		})
+		return
+	}
+
+	var tasks []*DownloadTask
+	for _, f := range files {
+		rel, err := safeRelativePath(f.RelPath)
+		if err != nil {
+			continue
+		}
+		task := d.newUserTask(f.URL)
+		task.OutputFile = filepath.Join(d.taskFolder(task), filepath.FromSlash(rel))
+		task.TotalSize = f.Size
+		task.infoKnown = true
+		tasks = append(tasks, task)
+	}
+
+	fyne.Do(func() {
+		if len(tasks) == 0 {
+			dialog.ShowInformation("Nothing to download", "No files found at "+urlStr, d.window)
+			return
+		}
+		for _, task := range tasks {
+			d.addTask(task)
+		}
+	})
+}
+
+// limitedReadCloser stops after a range has been read and closes the
+// underlying stream.
+type limitedReadCloser struct {
+	io.Reader
+	closer func() error
+}
+
+func (l *limitedReadCloser) Close() error {
+	return l.closer()
+}
+
+func newRangeReader(r io.Reader, start, end int64, closer func() error) io.ReadCloser {
+	if end >= 0 {
+		r = io.LimitReader(r, end-start+1)
+	}
+	return &limitedReadCloser{Reader: r, closer: closer}
+}
@@ -0,0 +1,741 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Playlists and manifests are small text documents.
+const maxManifestSize = 16 * 1024 * 1024
+
+// Attempts per segment before the stream download fails.
+const maxSegmentRetries = 3
+
+// streamSegment is one piece of an HLS or DASH stream. Segments become the
+// task's chunks and are concatenated in order.
+type streamSegment struct {
+	URL    string
+	Start  int64
+	End    int64  // -1 for the whole resource
+	KeyURL string // AES-128 key for encrypted HLS segments
+	IV     []byte
+}
+
+type streamInfo struct {
+	Segments []streamSegment
+	mu       sync.Mutex
+	keys     map[string][]byte
+}
+
+// streamVariant is a bitrate or track the user can pick.
+type streamVariant struct {
+	Label     string
+	Bandwidth int
+	load      func() ([]streamSegment, string, error) // Segments and file extension
+}
+
+func isStreamURL(urlStr string) bool {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	p := strings.ToLower(u.Path)
+	return strings.HasSuffix(p, ".m3u8") || strings.HasSuffix(p, ".mpd")
+}
+
+func fetchManifest(urlStr string) ([]byte, error) {
+	return fetchSmallFile(urlStr, maxManifestSize)
+}
+
+// fetchSmallFile reads a whole remote file, refusing one over limit bytes
+// rather than returning it cut short.
+func fetchSmallFile(urlStr string, limit int64) ([]byte, error) {
+	body, err := openRange(urlStr, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("file is larger than %d MB", limit/(1024*1024))
+	}
+	return data, nil
+}
+
+// queueStream loads a playlist or manifest, asks which variant to fetch
+// when there is a choice, and queues it as one task.
+func (d *Downloader) queueStream(urlStr string) {
+	base, err := url.Parse(urlStr)
+	var variants []streamVariant
+	if err == nil {
+		var data []byte
+		data, err = fetchManifest(urlStr)
+		if err == nil {
+			if strings.HasSuffix(strings.ToLower(base.Path), ".mpd") {
+				variants, err = parseDASH(base, data)
+			} else {
+				variants, err = parseHLS(base, data)
+			}
+		}
+	}
+	if err == nil && len(variants) == 0 {
+		err = fmt.Errorf("no playable streams found")
+	}
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("Failed to load stream: %v", err), d.window)
+		})
+		return
+	}
+
+	// Highest quality first
+	sort.SliceStable(variants, func(i, j int) bool {
+		return variants[i].Bandwidth > variants[j].Bandwidth
+	})
+
+	name := strings.TrimSuffix(path.Base(base.Path), path.Ext(base.Path))
+	if name == "" || name == "." || name == "/" {
+		name = "stream"
+	}
+
+	if len(variants) == 1 {
+		d.queueStreamVariant(name, urlStr, variants[0])
+		return
+	}
+
+	fyne.Do(func() {
+		labels := make([]string, len(variants))
+		for i, v := range variants {
+			labels[i] = v.Label
+		}
+		choice := widget.NewSelect(labels, nil)
+		choice.SetSelectedIndex(0)
+
+		dialog.ShowCustomConfirm("Choose Stream", "Download", "Cancel", choice, func(ok bool) {
+			if !ok || choice.SelectedIndex() < 0 {
+				return
+			}
+			v := variants[choice.SelectedIndex()]
+			go d.queueStreamVariant(name, urlStr, v)
+		}, d.window)
+	})
+}
+
+func (d *Downloader) queueStreamVariant(name, urlStr string, v streamVariant) {
+	segments, ext, err := v.load()
+	if err == nil && len(segments) == 0 {
+		err = fmt.Errorf("stream has no segments")
+	}
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("Failed to load stream: %v", err), d.window)
+		})
+		return
+	}
+
+	task := d.newUserTask(urlStr)
+	task.stream = &streamInfo{Segments: segments, keys: make(map[string][]byte)}
+	task.OutputFile = filepath.Join(d.taskFolder(task), name+ext)
+	task.infoKnown = true
+
+	fyne.Do(func() {
+		d.addTask(task)
+	})
+}
+
+// initializeStreamChunks turns every segment into a chunk.
+func (d *Downloader) initializeStreamChunks(task *DownloadTask) {
+	task.ChunkCount = len(task.stream.Segments)
+	task.Chunks = make([]ChunkInfo, task.ChunkCount)
+	for i, seg := range task.stream.Segments {
+		task.Chunks[i] = ChunkInfo{
+			Index:  i,
+			Start:  seg.Start,
+			End:    seg.End,
+			Status: "Pending",
+			Mirror: seg.URL,
+		}
+	}
+}
+
+// downloadSegment fetches a segment, retrying a few times since one lost
+// segment would spoil the whole stream.
+func (d *Downloader) downloadSegment(task *DownloadTask, chunk *ChunkInfo) {
+	for attempt := 0; attempt < maxSegmentRetries; attempt++ {
+		d.downloadChunk(task, chunk)
+		if chunk.Status == "Completed" || task.Status == "Cancelled" {
+			return
+		}
+
+		task.mu.Lock()
+		task.Downloaded -= chunk.Downloaded
+		task.mu.Unlock()
+		chunk.Downloaded = 0
+		chunk.Progress = 0
+	}
+}
+
+// decryptSegment decrypts an AES-128 HLS segment's part file in place.
+func (d *Downloader) decryptSegment(task *DownloadTask, chunk *ChunkInfo) error {
+	seg := task.stream.Segments[chunk.Index]
+	if seg.KeyURL == "" {
+		return nil
+	}
+
+	key, err := task.stream.key(seg.KeyURL)
+	if err != nil {
+		return err
+	}
+
+	tempFile := fmt.Sprintf("%s.part%d", task.OutputFile, chunk.Index)
+	data, err := os.ReadFile(tempFile)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return fmt.Errorf("encrypted segment has invalid length %d", len(data))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	cipher.NewCBCDecrypter(block, seg.IV).CryptBlocks(data, data)
+
+	// Strip PKCS#7 padding
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(data) {
+		return fmt.Errorf("bad padding, wrong key?")
+	}
+	return os.WriteFile(tempFile, data[:len(data)-pad], 0644)
+}
+
+// key fetches and caches an AES-128 key.
+func (s *streamInfo) key(keyURL string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[keyURL]; ok {
+		return key, nil
+	}
+	key, err := fetchManifest(keyURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key: %v", err)
+	}
+	if len(key) != 16 {
+		return nil, fmt.Errorf("AES-128 key is %d bytes", len(key))
+	}
+	s.keys[keyURL] = key
+	return key, nil
+}
+
+// HLS
+
+// parseHLS reads a master or media playlist. A master playlist yields one
+// variant per EXT-X-STREAM-INF; a media playlist yields a single variant.
+func parseHLS(base *url.URL, data []byte) ([]streamVariant, error) {
+	text := string(data)
+	if !strings.HasPrefix(strings.TrimPrefix(text, "\ufeff"), "#EXTM3U") {
+		return nil, fmt.Errorf("not an HLS playlist")
+	}
+
+	if !strings.Contains(text, "#EXT-X-STREAM-INF") {
+		segments, ext, err := parseHLSMedia(base, text)
+		if err != nil {
+			return nil, err
+		}
+		return []streamVariant{{
+			Label: "Default",
+			load:  func() ([]streamSegment, string, error) { return segments, ext, nil },
+		}}, nil
+	}
+
+	var variants []streamVariant
+	var pending map[string]string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			pending = parseM3UAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+		case line == "" || strings.HasPrefix(line, "#"):
+		case pending != nil:
+			ref, err := base.Parse(line)
+			if err != nil {
+				return nil, err
+			}
+			bandwidth, _ := strconv.Atoi(pending["BANDWIDTH"])
+			label := fmt.Sprintf("%.0f kbps", float64(bandwidth)/1000)
+			if res := pending["RESOLUTION"]; res != "" {
+				label = res + " - " + label
+			}
+
+			mediaURL := ref.String()
+			variants = append(variants, streamVariant{
+				Label:     label,
+				Bandwidth: bandwidth,
+				load: func() ([]streamSegment, string, error) {
+					data, err := fetchManifest(mediaURL)
+					if err != nil {
+						return nil, "", err
+					}
+					return parseHLSMedia(ref, string(data))
+				},
+			})
+			pending = nil
+		}
+	}
+	return variants, nil
+}
+
+// parseHLSMedia lists a media playlist's segments, resolving keys, IVs,
+// byte ranges and the fMP4 init section.
+func parseHLSMedia(base *url.URL, text string) ([]streamSegment, string, error) {
+	if strings.Contains(text, "#EXT-X-STREAM-INF") {
+		return nil, "", fmt.Errorf("expected a media playlist")
+	}
+
+	var segments []streamSegment
+	ext := ".ts"
+	sequence := uint64(0)
+	keyURL := ""
+	var keyIV []byte
+	var rangeLen, rangeStart int64 = -1, -1
+	lastEnd := map[string]int64{}
+	haveMap := false
+
+	resolve := func(ref string) (string, error) {
+		u, err := base.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			sequence, _ = strconv.ParseUint(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			attrs := parseM3UAttributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))
+			switch attrs["METHOD"] {
+			case "NONE":
+				keyURL, keyIV = "", nil
+			case "AES-128":
+				u, err := resolve(attrs["URI"])
+				if err != nil {
+					return nil, "", err
+				}
+				keyURL = u
+				keyIV = nil
+				if iv := attrs["IV"]; iv != "" {
+					b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X"))
+					if err != nil || len(b) != 16 {
+						return nil, "", fmt.Errorf("invalid key IV %q", iv)
+					}
+					keyIV = b
+				}
+			default:
+				return nil, "", fmt.Errorf("unsupported encryption %s", attrs["METHOD"])
+			}
+
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			if haveMap {
+				continue
+			}
+			attrs := parseM3UAttributes(strings.TrimPrefix(line, "#EXT-X-MAP:"))
+			u, err := resolve(attrs["URI"])
+			if err != nil {
+				return nil, "", err
+			}
+			seg := streamSegment{URL: u, End: -1}
+			if br := attrs["BYTERANGE"]; br != "" {
+				n, o := parseByteRange(br)
+				if o < 0 {
+					o = 0
+				}
+				seg.Start, seg.End = o, o+n-1
+			}
+			segments = append(segments, seg)
+			haveMap = true
+			ext = ".mp4"
+
+		case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+			rangeLen, rangeStart = parseByteRange(strings.TrimPrefix(line, "#EXT-X-BYTERANGE:"))
+
+		case line == "" || strings.HasPrefix(line, "#"):
+
+		default:
+			u, err := resolve(line)
+			if err != nil {
+				return nil, "", err
+			}
+			seg := streamSegment{URL: u, End: -1, KeyURL: keyURL}
+			if rangeLen >= 0 {
+				if rangeStart < 0 {
+					// Continues where the previous range of this resource ended
+					rangeStart = lastEnd[u]
+				}
+				seg.Start, seg.End = rangeStart, rangeStart+rangeLen-1
+				lastEnd[u] = seg.End + 1
+				rangeLen, rangeStart = -1, -1
+			}
+			if keyURL != "" {
+				seg.IV = keyIV
+				if seg.IV == nil {
+					// Default IV is the media sequence number
+					seg.IV = make([]byte, 16)
+					binary.BigEndian.PutUint64(seg.IV[8:], sequence)
+				}
+			}
+			segments = append(segments, seg)
+			sequence++
+		}
+	}
+	return segments, ext, nil
+}
+
+func parseByteRange(s string) (int64, int64) {
+	lengthStr, offsetStr, hasOffset := strings.Cut(strings.TrimSpace(s), "@")
+	n, _ := strconv.ParseInt(lengthStr, 10, 64)
+	if !hasOffset {
+		return n, -1
+	}
+	o, _ := strconv.ParseInt(offsetStr, 10, 64)
+	return n, o
+}
+
+// parseM3UAttributes splits KEY=VALUE,KEY="quoted, value" lists.
+func parseM3UAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.TrimSpace(key)
+
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.Index(rest[1:], "\"")
+			if end == -1 {
+				value, s = rest[1:], ""
+			} else {
+				value, s = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+		}
+		attrs[key] = value
+		s = strings.TrimPrefix(s, ",")
+	}
+	return attrs
+}
+
+// DASH
+
+type mpdDocument struct {
+	Type     string      `xml:"type,attr"`
+	Duration string      `xml:"mediaPresentationDuration,attr"`
+	BaseURL  string      `xml:"BaseURL"`
+	Periods  []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	Duration       string             `xml:"duration,attr"`
+	BaseURL        string             `xml:"BaseURL"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	MimeType        string              `xml:"mimeType,attr"`
+	ContentType     string              `xml:"contentType,attr"`
+	Lang            string              `xml:"lang,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+	Representations []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID              string              `xml:"id,attr"`
+	Bandwidth       int                 `xml:"bandwidth,attr"`
+	Width           int                 `xml:"width,attr"`
+	Height          int                 `xml:"height,attr"`
+	MimeType        string              `xml:"mimeType,attr"`
+	Codecs          string              `xml:"codecs,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *mpdSegmentList     `xml:"SegmentList"`
+}
+
+type mpdSegmentTemplate struct {
+	Media          string `xml:"media,attr"`
+	Initialization string `xml:"initialization,attr"`
+	StartNumber    *int64 `xml:"startNumber,attr"`
+	Timescale      int64  `xml:"timescale,attr"`
+	Duration       int64  `xml:"duration,attr"`
+	Timeline       *struct {
+		S []struct {
+			T *int64 `xml:"t,attr"`
+			D int64  `xml:"d,attr"`
+			R int64  `xml:"r,attr"`
+		} `xml:"S"`
+	} `xml:"SegmentTimeline"`
+}
+
+type mpdSegmentList struct {
+	Initialization *struct {
+		SourceURL string `xml:"sourceURL,attr"`
+	} `xml:"Initialization"`
+	SegmentURLs []struct {
+		Media string `xml:"media,attr"`
+	} `xml:"SegmentURL"`
+}
+
+// parseDASH lists every representation of a static MPD's first period.
+// Audio and video are separate representations in DASH, so each download
+// is a single track.
+func parseDASH(base *url.URL, data []byte) ([]streamVariant, error) {
+	var doc mpdDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid MPD: %v", err)
+	}
+	if doc.Type == "dynamic" {
+		return nil, fmt.Errorf("live DASH streams are not supported")
+	}
+	if len(doc.Periods) == 0 {
+		return nil, fmt.Errorf("MPD has no periods")
+	}
+	period := doc.Periods[0]
+
+	total := parseISODuration(period.Duration)
+	if total == 0 {
+		total = parseISODuration(doc.Duration)
+	}
+
+	periodBase, err := resolveBaseURL(base, doc.BaseURL, period.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []streamVariant
+	for _, set := range period.AdaptationSets {
+		setBase, err := resolveBaseURL(periodBase, set.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		for _, rep := range set.Representations {
+			repBase, err := resolveBaseURL(setBase, rep.BaseURL)
+			if err != nil {
+				return nil, err
+			}
+
+			mimeType := firstNonEmpty(rep.MimeType, set.MimeType)
+			template := rep.SegmentTemplate
+			if template == nil {
+				template = set.SegmentTemplate
+			}
+
+			kind := firstNonEmpty(set.ContentType, strings.Split(mimeType, "/")[0])
+			label := fmt.Sprintf("%s %.0f kbps", kind, float64(rep.Bandwidth)/1000)
+			if rep.Height > 0 {
+				label = fmt.Sprintf("%s %dx%d %.0f kbps", kind, rep.Width, rep.Height, float64(rep.Bandwidth)/1000)
+			}
+			if set.Lang != "" {
+				label += " (" + set.Lang + ")"
+			}
+
+			ext := ".mp4"
+			if strings.HasPrefix(mimeType, "audio/") {
+				ext = ".m4a"
+			} else if strings.Contains(mimeType, "webm") {
+				ext = ".webm"
+			}
+
+			rep := rep
+			variants = append(variants, streamVariant{
+				Label:     label,
+				Bandwidth: rep.Bandwidth,
+				load: func() ([]streamSegment, string, error) {
+					segments, err := dashSegments(repBase, rep, template, total)
+					return segments, ext, err
+				},
+			})
+		}
+	}
+	return variants, nil
+}
+
+func resolveBaseURL(base *url.URL, refs ...string) (*url.URL, error) {
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		u, err := base.Parse(ref)
+		if err != nil {
+			return nil, err
+		}
+		base = u
+	}
+	return base, nil
+}
+
+var dashIdentifier = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth)(%0\d+d)?\$`)
+
+func expandDASHTemplate(tmpl string, rep mpdRepresentation, number, t int64) string {
+	out := dashIdentifier.ReplaceAllStringFunc(tmpl, func(m string) string {
+		parts := dashIdentifier.FindStringSubmatch(m)
+		format := "%d"
+		if parts[2] != "" {
+			format = parts[2]
+		}
+		switch parts[1] {
+		case "RepresentationID":
+			return rep.ID
+		case "Number":
+			return fmt.Sprintf(format, number)
+		case "Time":
+			return fmt.Sprintf(format, t)
+		case "Bandwidth":
+			return fmt.Sprintf(format, rep.Bandwidth)
+		}
+		return m
+	})
+	return strings.ReplaceAll(out, "$$", "$")
+}
+
+func dashSegments(base *url.URL, rep mpdRepresentation, template *mpdSegmentTemplate, total float64) ([]streamSegment, error) {
+	resolve := func(ref string) (streamSegment, error) {
+		u, err := base.Parse(ref)
+		if err != nil {
+			return streamSegment{}, err
+		}
+		return streamSegment{URL: u.String(), End: -1}, nil
+	}
+
+	var segments []streamSegment
+	add := func(ref string) error {
+		seg, err := resolve(ref)
+		if err != nil {
+			return err
+		}
+		segments = append(segments, seg)
+		return nil
+	}
+
+	switch {
+	case rep.SegmentList != nil:
+		if init := rep.SegmentList.Initialization; init != nil && init.SourceURL != "" {
+			if err := add(init.SourceURL); err != nil {
+				return nil, err
+			}
+		}
+		for _, s := range rep.SegmentList.SegmentURLs {
+			if err := add(s.Media); err != nil {
+				return nil, err
+			}
+		}
+
+	case template != nil:
+		if template.Initialization != "" {
+			if err := add(expandDASHTemplate(template.Initialization, rep, 0, 0)); err != nil {
+				return nil, err
+			}
+		}
+
+		number := int64(1)
+		if template.StartNumber != nil {
+			number = *template.StartNumber
+		}
+		timescale := template.Timescale
+		if timescale == 0 {
+			timescale = 1
+		}
+
+		if template.Timeline != nil {
+			t := int64(0)
+			for _, s := range template.Timeline.S {
+				if s.T != nil {
+					t = *s.T
+				}
+				repeat := s.R
+				if repeat < 0 {
+					// Repeat until the end of the period
+					if total == 0 || s.D == 0 {
+						return nil, fmt.Errorf("open-ended SegmentTimeline without a duration")
+					}
+					repeat = int64(math.Ceil((total*float64(timescale)-float64(t))/float64(s.D))) - 1
+				}
+				for i := int64(0); i <= repeat; i++ {
+					if err := add(expandDASHTemplate(template.Media, rep, number, t)); err != nil {
+						return nil, err
+					}
+					number++
+					t += s.D
+				}
+			}
+		} else {
+			if template.Duration == 0 || total == 0 {
+				return nil, fmt.Errorf("cannot work out segment count for %s", rep.ID)
+			}
+			count := int64(math.Ceil(total * float64(timescale) / float64(template.Duration)))
+			for i := int64(0); i < count; i++ {
+				t := i * template.Duration
+				if err := add(expandDASHTemplate(template.Media, rep, number+i, t)); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+	default:
+		// A single file per representation
+		segments = append(segments, streamSegment{URL: base.String(), End: -1})
+	}
+
+	return segments, nil
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration converts durations like PT1H2M3.5S to seconds.
+func parseISODuration(s string) float64 {
+	m := isoDuration.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0
+	}
+	var total float64
+	for i, scale := range []float64{86400, 3600, 60, 1} {
+		if m[i+1] != "" {
+			v, _ := strconv.ParseFloat(m[i+1], 64)
+			total += v * scale
+		}
+	}
+	return total
+}
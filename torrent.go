@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// .torrent files are small; refuse anything unreasonably large.
+const maxTorrentFileSize = 32 * 1024 * 1024
+
+func isTorrentURL(urlStr string) bool {
+	if strings.HasPrefix(strings.ToLower(urlStr), "magnet:") {
+		return true
+	}
+	p := urlStr
+	if u, err := url.Parse(urlStr); err == nil && u.Path != "" {
+		p = u.Path
+	}
+	return strings.HasSuffix(strings.ToLower(p), ".torrent")
+}
+
+// getTorrentClient returns the shared BitTorrent client, starting it on first
+// use.
+func (d *Downloader) getTorrentClient() (*torrent.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.torrentClient != nil {
+		return d.torrentClient, nil
+	}
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.Seed = true
+	cfg.DataDir = d.outputFolder
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		// Default port taken, e.g. by another client; let the OS pick
+		cfg.ListenPort = 0
+		client, err = torrent.NewClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	d.torrentClient = client
+	return client, nil
+}
+
+// torrentSpec builds a spec from a magnet link, a .torrent URL or a local
+// .torrent file.
+func torrentSpec(urlStr string) (*torrent.TorrentSpec, error) {
+	if strings.HasPrefix(strings.ToLower(urlStr), "magnet:") {
+		return torrent.TorrentSpecFromMagnetUri(urlStr)
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var mi *metainfo.MetaInfo
+	if u.Scheme != "" && u.Scheme != "file" {
+		var data []byte
+		data, err = fetchSmallFile(urlStr, maxTorrentFileSize)
+		if err == nil {
+			mi, err = metainfo.Load(bytes.NewReader(data))
+		}
+	} else {
+		mi, err = metainfo.LoadFromFile(localPath(u))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid torrent: %v", err)
+	}
+	return torrent.TorrentSpecFromMetaInfoErr(mi)
+}
+
+// downloadTorrent drives a torrent through metadata, file selection,
+// download and seeding. Pieces map onto the task's chunks; the library
+// verifies each piece hash before marking it complete.
+func (d *Downloader) downloadTorrent(task *DownloadTask) {
+	fail := func(err error) {
+		task.Status = "Failed"
+		fyne.Do(func() {
+			task.updateStatusDisplay()
+			task.speedLabel.SetText(err.Error())
+			task.actionButton.SetIcon(theme.ViewRefreshIcon())
+		})
+		d.updateStats()
+	}
+
+	client, err := d.getTorrentClient()
+	if err != nil {
+		fail(fmt.Errorf("BitTorrent unavailable: %v", err))
+		return
+	}
+
+	spec, err := torrentSpec(task.URL)
+	if err != nil {
+		fail(err)
+		return
+	}
+	outputDir := d.taskFolder(task)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		fail(err)
+		return
+	}
+	pieceStorage := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   outputDir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	spec.Storage = pieceStorage
+
+	t, _, err := client.AddTorrentSpec(spec)
+	if err != nil {
+		pieceStorage.Close()
+		fail(err)
+		return
+	}
+	task.cancelFunc = t.Drop
+
+	task.Status = "Fetching metadata"
+	fyne.Do(func() {
+		task.updateStatusDisplay()
+	})
+
+	for waiting := true; waiting; {
+		select {
+		case <-t.GotInfo():
+			waiting = false
+		case <-time.After(500 * time.Millisecond):
+			if task.Status == "Cancelled" {
+				t.Drop()
+				return
+			}
+		}
+	}
+
+	files := t.Files()
+	selected := files
+	if len(files) > 1 {
+		selected = d.chooseTorrentFiles(t.Name(), files)
+		if len(selected) == 0 {
+			t.Drop()
+			d.removeTask(task)
+			return
+		}
+	}
+
+	wanted := make(map[*torrent.File]bool)
+	task.TotalSize = 0
+	for _, f := range selected {
+		wanted[f] = true
+		task.TotalSize += f.Length()
+	}
+	for _, f := range files {
+		if wanted[f] {
+			f.Download()
+		} else {
+			f.SetPriority(torrent.PiecePriorityNone)
+		}
+	}
+
+	task.OutputFile = filepath.Join(outputDir, t.Info().BestName())
+	pieceLength := t.Info().PieceLength
+	task.ChunkCount = t.NumPieces()
+	task.Chunks = make([]ChunkInfo, task.ChunkCount)
+	for i := range task.Chunks {
+		start := int64(i) * pieceLength
+		end := start + pieceLength - 1
+		if end >= t.Length() {
+			end = t.Length() - 1
+		}
+		task.Chunks[i] = ChunkInfo{Index: i, Start: start, End: end, Status: "Pending"}
+	}
+
+	task.Status = "Downloading"
+	fileName := t.Name()
+	fyne.Do(func() {
+		task.fileNameLabel.SetText(fileName)
+		task.updateStatusDisplay()
+	})
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	paused := false
+	lastCompleted := int64(0)
+	for range ticker.C {
+		switch {
+		case task.Status == "Cancelled":
+			t.Drop()
+			return
+		case task.Status == "Paused" && !paused:
+			t.DisallowDataDownload()
+			paused = true
+		case task.Status == "Downloading" && paused:
+			t.AllowDataDownload()
+			paused = false
+		}
+
+		completed := int64(0)
+		for _, f := range selected {
+			completed += f.BytesCompleted()
+		}
+		task.mu.Lock()
+		task.Downloaded = completed
+		task.mu.Unlock()
+
+		for i := range task.Chunks {
+			ps := t.PieceState(i)
+			switch {
+			case ps.Complete:
+				task.Chunks[i].Status = "Completed"
+				task.Chunks[i].Progress = 1
+			case ps.Hashing || ps.QueuedForHash:
+				task.Chunks[i].Status = "Verifying"
+			case ps.Partial:
+				task.Chunks[i].Status = "Downloading"
+			}
+		}
+
+		speed := float64(completed-lastCompleted) * 2 / (1024 * 1024)
+		lastCompleted = completed
+		peers := t.Stats().ActivePeers
+
+		progress := 0.0
+		if task.TotalSize > 0 {
+			progress = float64(completed) / float64(task.TotalSize)
+		}
+		fyne.Do(func() {
+			task.progressBar.SetValue(progress)
+			task.speedLabel.SetText(fmt.Sprintf("%.1f MB | %.2f MB/s | %d peers",
+				float64(task.TotalSize)/(1024*1024), speed, peers))
+			task.updateStatusDisplay()
+		})
+
+		if completed >= task.TotalSize {
+			break
+		}
+	}
+
+	d.finishTorrent(task, t)
+}
+
+// finishTorrent marks the task done and keeps seeding until the ratio
+// limit is reached or the task is removed.
+func (d *Downloader) finishTorrent(task *DownloadTask, t *torrent.Torrent) {
+	fyne.Do(func() {
+		task.progressBar.SetValue(1.0)
+		task.actionButton.SetIcon(theme.FolderOpenIcon())
+		task.actionButton.OnTapped = func() {
+			d.openFileLocation(task.OutputFile)
+		}
+	})
+	// The files are complete whether or not we go on seeding
+	d.runPostActions(task)
+
+	if d.config().SeedRatio <= 0 || task.TotalSize == 0 {
+		t.Drop()
+		task.Status = "Completed"
+		fyne.Do(func() {
+			task.updateStatusDisplay()
+		})
+		d.updateStats()
+		return
+	}
+
+	task.Status = "Seeding"
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if task.Status == "Cancelled" {
+			t.Drop()
+			return
+		}
+
+		// Read every tick so a changed setting applies to running seeds
+		limit := d.config().SeedRatio
+		stats := t.Stats()
+		uploaded := stats.BytesWrittenData.Int64()
+		ratio := float64(uploaded) / float64(task.TotalSize)
+		peers := stats.ActivePeers
+		fyne.Do(func() {
+			task.speedLabel.SetText(fmt.Sprintf("Ratio %.2f / %.2f | %d peers", ratio, limit, peers))
+			task.updateStatusDisplay()
+		})
+
+		if ratio >= limit {
+			break
+		}
+	}
+
+	t.Drop()
+	task.Status = "Completed"
+	fyne.Do(func() {
+		task.updateStatusDisplay()
+	})
+	d.updateStats()
+}
+
+// chooseTorrentFiles asks which files of a multi-file torrent to fetch and
+// blocks until the user answers. Returns nil on cancel.
+func (d *Downloader) chooseTorrentFiles(name string, files []*torrent.File) []*torrent.File {
+	result := make(chan []*torrent.File, 1)
+
+	fyne.Do(func() {
+		checks := make([]*widget.Check, len(files))
+		list := container.NewVBox()
+		for i, f := range files {
+			label := fmt.Sprintf("%s (%.1f MB)", f.DisplayPath(), float64(f.Length())/(1024*1024))
+			checks[i] = widget.NewCheck(label, nil)
+			checks[i].SetChecked(true)
+			list.Add(checks[i])
+		}
+		scroll := container.NewVScroll(list)
+		scroll.SetMinSize(fyne.NewSize(500, 300))
+
+		picker := dialog.NewCustomConfirm("Select Files - "+name, "Download", "Cancel", scroll, func(ok bool) {
+			if !ok {
+				result <- nil
+				return
+			}
+			var selected []*torrent.File
+			for i, check := range checks {
+				if check.Checked {
+					selected = append(selected, files[i])
+				}
+			}
+			result <- selected
+		}, d.window)
+		picker.Show()
+	})
+
+	return <-result
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/test"
+	"fyne.io/fyne/v2/widget"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestTorrentSpecSizeLimit(t *testing.T) {
+	big := make([]byte, maxTorrentFileSize+1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(big)
+	}))
+	defer srv.Close()
+
+	_, err := torrentSpec(srv.URL + "/big.torrent")
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("oversized torrent file: got %v, want a size error", err)
+	}
+}
+
+// testClientConfig keeps a client to loopback with no DHT or port mapping.
+func testClientConfig(dir string) *torrent.ClientConfig {
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = dir
+	cfg.ListenHost = func(string) string { return "127.0.0.1" }
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableIPv6 = true
+	cfg.NoDefaultPortForwarding = true
+	cfg.DisablePEX = true
+	return cfg
+}
+
+// startSeeder shares a random file from a client of its own and returns
+// the file's contents, its metainfo and the seeder's port.
+func startSeeder(t *testing.T, announce string) ([]byte, *metainfo.MetaInfo, int) {
+	dir := t.TempDir()
+	data := make([]byte, 300*1024)
+	rand.Read(data)
+	path := filepath.Join(dir, "payload.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info := metainfo.Info{PieceLength: 32 * 1024}
+	if err := info.BuildFromFilePath(path); err != nil {
+		t.Fatal(err)
+	}
+	mi := &metainfo.MetaInfo{Announce: announce}
+	var err error
+	if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testClientConfig(dir)
+	cfg.Seed = true
+	cfg.DisableTrackers = true
+	seeder, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { seeder.Close() })
+
+	tor, err := seeder.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.VerifyData(); err != nil {
+		t.Fatal(err)
+	}
+	if !tor.Complete().Bool() {
+		t.Fatal("seeder does not have the whole file")
+	}
+	return data, mi, seeder.LocalPort()
+}
+
+// runTorrentTask downloads urlStr with a fresh client and returns the task
+// once it has finished. setup, if not nil, adjusts the task first.
+func runTorrentTask(t *testing.T, urlStr string, setup func(*DownloadTask)) (*DownloadTask, string) {
+	test.NewApp()
+
+	outputDir := t.TempDir()
+	client, err := torrent.NewClient(testClientConfig(outputDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	d := &Downloader{
+		tasks:         map[string]*DownloadTask{},
+		statsLabel:    widget.NewLabel(""),
+		outputFolder:  outputDir,
+		torrentClient: client,
+		settings:      appSettings{SeedRatio: 0}, // Finish without seeding
+	}
+	task := &DownloadTask{
+		URL:           urlStr,
+		Status:        "Preparing...",
+		fileNameLabel: widget.NewLabel(""),
+		statusLabel:   widget.NewLabel(""),
+		speedLabel:    widget.NewLabel(""),
+		progressBar:   widget.NewProgressBar(),
+		actionButton:  widget.NewButton("", nil),
+	}
+	if setup != nil {
+		setup(task)
+	}
+	d.tasks[urlStr] = task
+
+	done := make(chan struct{})
+	go func() {
+		d.downloadTorrent(task)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(60 * time.Second):
+		status := task.Status
+		task.Status = "Cancelled"
+		t.Fatalf("torrent did not finish; status %q", status)
+	}
+	return task, outputDir
+}
+
+func checkTorrentResult(t *testing.T, task *DownloadTask, want []byte) {
+	if task.Status != "Completed" {
+		t.Fatalf("status %q, want Completed", task.Status)
+	}
+	got, err := os.ReadFile(task.OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes that differ from the %d seeded", len(got), len(want))
+	}
+}
+
+func TestDownloadTorrentFromTracker(t *testing.T) {
+	var seederPort int
+	var torrentFile bytes.Buffer
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file.torrent", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(torrentFile.Bytes())
+	})
+	// A tracker that knows one peer: the seeder
+	mux.HandleFunc("/announce", func(w http.ResponseWriter, r *http.Request) {
+		peer := make([]byte, 6)
+		copy(peer, []byte{127, 0, 0, 1})
+		binary.BigEndian.PutUint16(peer[4:], uint16(seederPort))
+		resp, _ := bencode.Marshal(map[string]any{"interval": 60, "peers": string(peer)})
+		w.Write(resp)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	data, mi, port := startSeeder(t, srv.URL+"/announce")
+	seederPort = port
+	if err := mi.Write(&torrentFile); err != nil {
+		t.Fatal(err)
+	}
+
+	task, outputDir := runTorrentTask(t, srv.URL+"/file.torrent", nil)
+	checkTorrentResult(t, task, data)
+	if filepath.Dir(task.OutputFile) != outputDir {
+		t.Errorf("saved to %s, want %s", task.OutputFile, outputDir)
+	}
+}
+
+func TestDownloadTorrentFromMagnetPeer(t *testing.T) {
+	data, mi, port := startSeeder(t, "")
+	// Metadata and pieces both come from the peer named in x.pe
+	magnet := "magnet:?xt=urn:btih:" + mi.HashInfoBytes().HexString() +
+		"&x.pe=127.0.0.1:" + strconv.Itoa(port)
+
+	task, _ := runTorrentTask(t, magnet, nil)
+	checkTorrentResult(t, task, data)
+}
+
+func TestTorrentRunsPostActions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses cp as the after-download command")
+	}
+	data, mi, port := startSeeder(t, "")
+	magnet := "magnet:?xt=urn:btih:" + mi.HashInfoBytes().HexString() +
+		"&x.pe=127.0.0.1:" + strconv.Itoa(port)
+	copyPath := filepath.Join(t.TempDir(), "copy.bin")
+
+	task, _ := runTorrentTask(t, magnet, func(task *DownloadTask) {
+		task.OnComplete = "cp {file} " + copyPath
+	})
+	checkTorrentResult(t, task, data)
+
+	// The command runs in the background
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got, err := os.ReadFile(copyPath)
+		if err == nil && bytes.Equal(got, data) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("after-download command did not copy the file: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	// Shortest allowed interval between checks.
+	minWatchInterval = time.Minute
+	// History entries kept per watched task.
+	maxWatchHistory = 500
+	// Timestamp appended to kept versions: name.20250908-020000.ext
+	versionStamp = "20060102-150405"
+)
+
+var versionPattern = regexp.MustCompile(`\.\d{8}-\d{6}$`)
+
+// watchSpec turns a task into a recurring download that re-checks its URL
+// and only downloads when the remote file changed.
+type watchSpec struct {
+	Schedule string        // As typed, for display
+	Interval time.Duration // Set for "every N" schedules
+	Cron     *cronSchedule // Set for cron expressions
+	Keep     int           // Previous versions to keep; 0 overwrites
+
+	mu      sync.Mutex
+	history []watchCheck
+	last    *remoteVersion
+}
+
+type watchCheck struct {
+	Time   time.Time
+	Result string
+}
+
+// remoteVersion is what identifies one build of the remote file.
+type remoteVersion struct {
+	ETag         string
+	LastModified string
+	Size         int64
+}
+
+func (v remoteVersion) known() bool {
+	return v.ETag != "" || v.LastModified != "" || v.Size > 0
+}
+
+func (w *watchSpec) next(after time.Time) time.Time {
+	if w.Cron != nil {
+		return w.Cron.next(after)
+	}
+	return after.Add(w.Interval)
+}
+
+func (w *watchSpec) record(result string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.history = append(w.history, watchCheck{Time: time.Now(), Result: result})
+	if len(w.history) > maxWatchHistory {
+		w.history = w.history[len(w.history)-maxWatchHistory:]
+	}
+}
+
+// parseWatchSchedule accepts a Go duration ("6h", "30m"), a cron macro
+// ("@daily") or a five-field cron expression ("0 2 * * *").
+func parseWatchSchedule(s string) (*watchSpec, error) {
+	s = strings.TrimSpace(s)
+	w := &watchSpec{Schedule: s}
+
+	if interval, err := time.ParseDuration(s); err == nil {
+		if interval < minWatchInterval {
+			return nil, fmt.Errorf("interval must be at least %v", minWatchInterval)
+		}
+		w.Interval = interval
+		return w, nil
+	}
+
+	cron, err := parseCron(s)
+	if err != nil {
+		return nil, fmt.Errorf("schedule must be a duration like 6h or a cron expression: %v", err)
+	}
+	w.Cron = cron
+	return w, nil
+}
+
+// runWatch checks the URL on schedule until the task is removed.
+func (d *Downloader) runWatch(task *DownloadTask) {
+	w := task.watch
+
+	for task.Status != "Cancelled" {
+		d.checkWatch(task)
+		if task.Status == "Cancelled" {
+			return
+		}
+
+		next := w.next(time.Now())
+		task.Status = "Watching"
+		w.mu.Lock()
+		checks := len(w.history)
+		w.mu.Unlock()
+		fyne.Do(func() {
+			task.updateStatusDisplay()
+			task.speedLabel.SetText(fmt.Sprintf("Next check %s | %d checks",
+				next.Format("Jan 2 15:04"), checks))
+			task.actionButton.SetIcon(theme.FolderOpenIcon())
+			task.actionButton.OnTapped = func() {
+				d.openFileLocation(task.OutputFile)
+			}
+		})
+		d.updateStats()
+
+		for time.Now().Before(next) {
+			if task.Status == "Cancelled" {
+				return
+			}
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// checkWatch asks the server for the current version and downloads it if
+// it differs from the last one we fetched.
+func (d *Downloader) checkWatch(task *DownloadTask) {
+	w := task.watch
+
+	probe := &DownloadTask{ID: task.ID, URL: task.URL, OutputDir: task.OutputDir,
+		FileName: task.FileName, Headers: task.Headers, Proxy: task.Proxy}
+	if err := d.getFileInfo(probe); err != nil {
+		w.record("Check failed: " + err.Error())
+		return
+	}
+	current := remoteVersion{ETag: probe.ETag, LastModified: probe.LastModified, Size: probe.TotalSize}
+
+	w.mu.Lock()
+	last := w.last
+	w.mu.Unlock()
+	if last != nil && current.known() && current == *last {
+		w.record("Unchanged")
+		return
+	}
+
+	// Run the normal pipeline on a fresh slate
+	task.Chunks = nil
+	task.Downloaded = 0
+	task.ChunkCount = d.chunkCount
+	task.Status = "Preparing..."
+	fyne.Do(func() {
+		task.progressBar.SetValue(0)
+		task.updateStatusDisplay()
+	})
+
+	// Fetch the new version beside the current one and only rotate once
+	// it has arrived intact
+	final := probe.OutputFile
+	if w.Keep > 0 {
+		task.OutputFile = final + ".download"
+		task.TotalSize = probe.TotalSize
+		task.ETag = probe.ETag
+		task.LastModified = probe.LastModified
+		task.infoKnown = true
+		task.onVerified = func() error {
+			if err := keepVersion(final, w.Keep); err != nil {
+				return fmt.Errorf("Could not keep previous version: %v", err)
+			}
+			if err := os.Rename(task.OutputFile, final); err != nil {
+				return err
+			}
+			task.OutputFile = final
+			return nil
+		}
+	}
+	d.downloadFile(task)
+	if w.Keep > 0 && task.OutputFile != final {
+		// Failed or cancelled: drop the unfinished new version
+		for i := range task.Chunks {
+			os.Remove(fmt.Sprintf("%s.part%d", task.OutputFile, i))
+		}
+		os.Remove(task.OutputFile)
+		task.OutputFile = final
+	}
+
+	switch task.Status {
+	case "Completed":
+		w.mu.Lock()
+		w.last = &current
+		w.mu.Unlock()
+		w.record(fmt.Sprintf("Downloaded %.1f MB", float64(task.TotalSize)/(1024*1024)))
+	case "Up to date":
+		w.mu.Lock()
+		w.last = &current
+		w.mu.Unlock()
+		w.record("Up to date")
+	case "Cancelled":
+	default:
+		w.record("Download failed")
+	}
+}
+
+// keepVersion renames the current output to a timestamped name and deletes
+// the oldest versions beyond keep. It runs once the replacement is ready.
+func keepVersion(outputFile string, keep int) error {
+	info, err := os.Stat(outputFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(outputFile)
+	base := strings.TrimSuffix(outputFile, ext)
+	versioned := base + "." + info.ModTime().Format(versionStamp) + ext
+	if err := os.Rename(outputFile, versioned); err != nil {
+		return err
+	}
+
+	matches, err := filepath.Glob(globEscape(base) + ".*" + globEscape(ext))
+	if err != nil {
+		return err
+	}
+	var versions []string
+	for _, m := range matches {
+		if versionPattern.MatchString(strings.TrimSuffix(m, ext)) {
+			versions = append(versions, m)
+		}
+	}
+	// Timestamps sort chronologically
+	sort.Strings(versions)
+	for len(versions) > keep {
+		os.Remove(versions[0])
+		versions = versions[1:]
+	}
+	return nil
+}
+
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (d *Downloader) showWatchHistory(task *DownloadTask) {
+	task.watch.mu.Lock()
+	history := append([]watchCheck(nil), task.watch.history...)
+	task.watch.mu.Unlock()
+
+	// Newest first
+	sort.Slice(history, func(i, j int) bool { return history[i].Time.After(history[j].Time) })
+
+	list := widget.NewList(
+		func() int { return len(history) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			check := history[id]
+			obj.(*widget.Label).SetText(check.Time.Format("2006-01-02 15:04:05") + "  " + check.Result)
+		},
+	)
+
+	title := fmt.Sprintf("History - %s (%s)", filepath.Base(task.OutputFile), task.watch.Schedule)
+	historyDialog := dialog.NewCustom(title, "Close", list, d.window)
+	historyDialog.Resize(fyne.NewSize(600, 400))
+	historyDialog.Show()
+}
+
+func (d *Downloader) showWatchDialog() {
+	urlEntry := widget.NewEntry()
+	urlEntry.SetPlaceHolder("https://example.com/nightly/build.zip")
+	urlEntry.SetText(strings.TrimSpace(d.urlEntry.Text))
+
+	scheduleEntry := widget.NewEntry()
+	scheduleEntry.SetPlaceHolder("6h, @daily or 0 2 * * *")
+	scheduleEntry.SetText("@daily")
+
+	keepEntry := widget.NewEntry()
+	keepEntry.SetText("0")
+
+	form := widget.NewForm(
+		widget.NewFormItem("URL", urlEntry),
+		widget.NewFormItem("Check every", scheduleEntry),
+		widget.NewFormItem("Keep versions", keepEntry),
+	)
+	content := container.NewVBox(form,
+		widget.NewLabel("Downloads only when the file changes. Keep 0 to overwrite."))
+
+	watchDialog := dialog.NewCustomConfirm("Watch URL", "Watch", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		w, err := parseWatchSchedule(scheduleEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, d.window)
+			return
+		}
+		if w.Keep, err = strconv.Atoi(strings.TrimSpace(keepEntry.Text)); err != nil || w.Keep < 0 {
+			dialog.ShowError(fmt.Errorf("Keep versions must be a whole number"), d.window)
+			return
+		}
+
+		urlStr := strings.TrimSpace(urlEntry.Text)
+		if filepath.IsAbs(urlStr) {
+			urlStr = fileURL(urlStr)
+		}
+		if urlStr == "" {
+			return
+		}
+
+		task := d.newUserTask(urlStr)
+		task.watch = w
+		d.addTask(task)
+	}, d.window)
+
+	watchDialog.Resize(fyne.NewSize(500, 250))
+	watchDialog.Show()
+}
+
+// cronSchedule is a standard five-field cron expression: minute, hour,
+// day of month, month and day of week.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@nightly":  "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	c := &cronSchedule{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// Both 0 and 7 mean Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+// parseCronField handles *, lists, ranges and steps such as 1-5,*/15.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	domOK := c.dom&(1<<uint(t.Day())) != 0
+	dowOK := c.dow&(1<<uint(t.Weekday())) != 0
+	// Cron ORs the two day fields when both are restricted
+	if !c.domAny && !c.dowAny {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+// next returns the first matching minute after t, or a year out if the
+// expression never matches (e.g. 30 February).
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	start := t
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return start.AddDate(1, 0, 0)
+}
@@ -0,0 +1,224 @@
+// Browser front end for the download manager. Task state comes from the
+// /api/events stream; actions go through the REST API.
+"use strict";
+
+const tasks = new Map(); // id -> task JSON
+const cards = new Map(); // id -> card element
+let events = null;
+
+async function api(method, path, body) {
+  const opts = { method, headers: { "X-Requested-With": "fetch" } };
+  if (body !== undefined) {
+    opts.headers["Content-Type"] = "application/json";
+    opts.body = JSON.stringify(body);
+  }
+  const resp = await fetch(path, opts);
+  if (resp.status === 401) {
+    showLogin();
+    throw new Error("login required");
+  }
+  const data = resp.status === 204 ? null : await resp.json();
+  if (!resp.ok) {
+    throw new Error(data && data.error ? data.error : resp.statusText);
+  }
+  return data;
+}
+
+function showLogin() {
+  if (events) {
+    events.close();
+    events = null;
+  }
+  document.getElementById("app").hidden = true;
+  document.getElementById("login").hidden = false;
+}
+
+async function start() {
+  try {
+    await api("GET", "/api/stats");
+  } catch (e) {
+    return;
+  }
+  document.getElementById("login").hidden = true;
+  document.getElementById("app").hidden = false;
+
+  tasks.clear();
+  cards.forEach((card) => card.remove());
+  cards.clear();
+
+  // A new stream first reports every existing task as added
+  events = new EventSource("/api/events");
+  for (const type of ["added", "state", "progress", "completed"]) {
+    events.addEventListener(type, (ev) => update(JSON.parse(ev.data).task));
+  }
+  events.addEventListener("removed", (ev) => remove(JSON.parse(ev.data).task.id));
+  events.onerror = () => {
+    // The browser retries on its own; make sure we are still logged in
+    api("GET", "/api/stats").catch(() => {});
+  };
+}
+
+function formatSize(bytes) {
+  if (bytes < 0) return "?";
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let i = 0;
+  while (bytes >= 1024 && i < units.length - 1) {
+    bytes /= 1024;
+    i++;
+  }
+  return (i === 0 ? bytes : bytes.toFixed(1)) + " " + units[i];
+}
+
+function fileName(task) {
+  if (task.file) return task.file.split(/[\\/]/).pop();
+  try {
+    return decodeURIComponent(new URL(task.url).pathname.split("/").pop()) || task.url;
+  } catch (e) {
+    return task.url;
+  }
+}
+
+function update(task) {
+  tasks.set(task.id, task);
+  let card = cards.get(task.id);
+  if (!card) {
+    card = document.getElementById("task-template").content.firstElementChild.cloneNode(true);
+    card.querySelector(".pause").onclick = () => act("POST", task.id, "/pause");
+    card.querySelector(".resume").onclick = () => act("POST", task.id, "/resume");
+    card.querySelector(".remove").onclick = () => act("DELETE", task.id, "");
+    cards.set(task.id, card);
+
+    // Files of a site mirror sit under their parent
+    const parent = task.parent && cards.get(task.parent);
+    if (parent) {
+      card.classList.add("child");
+      let after = parent;
+      while (after.nextElementSibling && after.nextElementSibling.classList.contains("child")) {
+        after = after.nextElementSibling;
+      }
+      after.after(card);
+    } else {
+      document.getElementById("tasks").append(card);
+    }
+  }
+
+  card.querySelector(".name").textContent = fileName(task);
+  card.querySelector(".url").textContent = task.url;
+  const status = card.querySelector(".status");
+  status.textContent = task.status;
+  status.className = "status status-" + task.status.split(" ")[0].replace(/\W/g, "");
+  card.querySelector("progress").value = task.progress;
+
+  let detail = formatSize(task.downloaded);
+  if (task.size > 0) detail += " / " + formatSize(task.size);
+  if (task.status === "Downloading") detail += " · " + (task.speed / 1048576).toFixed(2) + " MB/s";
+  card.querySelector(".speed").textContent = detail;
+
+  card.querySelector(".pause").hidden = task.status !== "Downloading";
+  card.querySelector(".resume").hidden = task.status !== "Paused";
+  updateStats();
+}
+
+function remove(id) {
+  tasks.delete(id);
+  const card = cards.get(id);
+  if (card) card.remove();
+  cards.delete(id);
+  updateStats();
+}
+
+// Same counts as the desktop status bar
+function updateStats() {
+  let active = 0, completed = 0, failed = 0;
+  for (const task of tasks.values()) {
+    if (["Downloading", "Preparing...", "Crawling", "Watching"].includes(task.status)) active++;
+    else if (task.status === "Completed" || task.status === "Up to date") completed++;
+    else if (task.status === "Failed") failed++;
+  }
+  document.getElementById("stats").textContent =
+    `Active: ${active} | Completed: ${completed} | Failed: ${failed}`;
+  document.getElementById("empty").hidden = tasks.size > 0;
+}
+
+async function act(method, id, suffix) {
+  try {
+    await api(method, "/api/tasks/" + encodeURIComponent(id) + suffix);
+  } catch (e) {
+    alert(e.message);
+  }
+}
+
+document.getElementById("login-form").onsubmit = async (ev) => {
+  ev.preventDefault();
+  const error = document.getElementById("login-error");
+  error.textContent = "";
+  const resp = await fetch("/login", { method: "POST", body: new FormData(ev.target) });
+  if (!resp.ok) {
+    error.textContent = resp.status === 429 ? "Too many wrong passwords, try again later" : "Wrong password";
+    return;
+  }
+  ev.target.reset();
+  start();
+};
+
+document.getElementById("logout-btn").onclick = async () => {
+  await fetch("/logout", { method: "POST" });
+  showLogin();
+};
+
+document.getElementById("add-form").onsubmit = async (ev) => {
+  ev.preventDefault();
+  const field = ev.target.elements.urls;
+  const urls = field.value.split("\n").map((s) => s.trim()).filter(Boolean);
+  const failed = [];
+  for (const url of urls) {
+    try {
+      await api("POST", "/api/tasks", { url });
+    } catch (e) {
+      failed.push(url + ": " + e.message);
+    }
+  }
+  field.value = "";
+  if (failed.length) alert("Not added:\n" + failed.join("\n"));
+};
+
+const settingsDialog = document.getElementById("settings");
+const settingsForm = document.getElementById("settings-form");
+
+document.getElementById("settings-btn").onclick = async () => {
+  const s = await api("GET", "/api/settings");
+  const f = settingsForm.elements;
+  f.downloadFolder.value = s.downloadFolder;
+  f.connections.value = s.connections;
+  f.seedRatio.value = s.seedRatio;
+  f.scheduleEnabled.checked = s.schedule.enabled;
+  f.windows.value = s.schedule.windows;
+  f.limitInside.value = s.schedule.limitInside;
+  f.limitOutside.value = s.schedule.limitOutside;
+  document.getElementById("settings-error").textContent = "";
+  settingsDialog.showModal();
+};
+
+document.getElementById("settings-save").onclick = async (ev) => {
+  ev.preventDefault();
+  if (!settingsForm.reportValidity()) return;
+  const f = settingsForm.elements;
+  try {
+    await api("PUT", "/api/settings", {
+      downloadFolder: f.downloadFolder.value,
+      connections: Number(f.connections.value),
+      seedRatio: Number(f.seedRatio.value),
+      schedule: {
+        enabled: f.scheduleEnabled.checked,
+        windows: f.windows.value,
+        limitInside: Number(f.limitInside.value),
+        limitOutside: Number(f.limitOutside.value),
+      },
+    });
+    settingsDialog.close();
+  } catch (e) {
+    document.getElementById("settings-error").textContent = e.message;
+  }
+};
+
+start();
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Stop walking a WebDAV tree after this many files.
+const maxWebDAVFiles = 10000
+
+func init() {
+	sources["dav"] = webdavSource{}
+	sources["davs"] = webdavSource{}
+}
+
+// webdavSource handles dav:// and davs:// (WebDAV over HTTP and HTTPS).
+// Files download with ranged GETs; collections are walked with PROPFIND
+// and every file below them is queued.
+type webdavSource struct{}
+
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href     string        `xml:"DAV: href"`
+	Propstat []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Prop struct {
+		ResourceType struct {
+			Collection *struct{} `xml:"DAV: collection"`
+		} `xml:"DAV: resourcetype"`
+		ContentLength int64 `xml:"DAV: getcontentlength"`
+	} `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type davEntry struct {
+	URL          *url.URL
+	IsCollection bool
+	Size         int64
+}
+
+const davPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/></prop></propfind>`
+
+// webdavHTTPURL maps dav:// to http:// and davs:// to https://.
+func webdavHTTPURL(u *url.URL) *url.URL {
+	out := *u
+	switch strings.ToLower(u.Scheme) {
+	case "dav":
+		out.Scheme = "http"
+	case "davs":
+		out.Scheme = "https"
+	}
+	return &out
+}
+
+func (webdavSource) stat(u *url.URL) (int64, string, error) {
+	entries, err := propfind(webdavHTTPURL(u), "0")
+	if err != nil {
+		return 0, "", err
+	}
+	if len(entries) == 0 {
+		return 0, "", fmt.Errorf("no properties returned for %s", u.Path)
+	}
+	if entries[0].IsCollection {
+		return 0, "", fmt.Errorf("%s is a folder", u.Path)
+	}
+	return entries[0].Size, path.Base(u.Path), nil
+}
+
+func (webdavSource) openRange(u *url.URL, start, end int64) (io.ReadCloser, error) {
+	return openHTTPRange(webdavHTTPURL(u).String(), start, end, nil, "")
+}
+
+// list walks a collection breadth-first. Plain http(s) URLs are first
+// checked with OPTIONS so non-WebDAV servers fall back to a normal download.
+func (webdavSource) list(u *url.URL) ([]remoteFile, error) {
+	root := webdavHTTPURL(u)
+	if root.Scheme == u.Scheme && !supportsWebDAV(root) {
+		return nil, nil
+	}
+
+	entries, err := propfind(root, "0")
+	if err != nil {
+		if root.Scheme == u.Scheme {
+			// Auto-detected server that turned out not to be WebDAV
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(entries) == 0 || !entries[0].IsCollection {
+		return nil, nil
+	}
+
+	rootPath := strings.TrimSuffix(root.Path, "/")
+	rootName := path.Base(rootPath)
+	if rootName == "." || rootName == "/" || rootName == "" {
+		rootName = root.Hostname()
+	}
+
+	files := []remoteFile{}
+	queue := []*url.URL{root}
+	seen := map[string]bool{rootPath: true}
+	for len(queue) > 0 && len(files) < maxWebDAVFiles {
+		dir := queue[0]
+		queue = queue[1:]
+
+		entries, err := propfind(dir, "1")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			entryPath := strings.TrimSuffix(e.URL.Path, "/")
+			if seen[entryPath] || !strings.HasPrefix(entryPath, rootPath+"/") {
+				continue
+			}
+			seen[entryPath] = true
+
+			if e.IsCollection {
+				if !strings.HasSuffix(e.URL.Path, "/") {
+					e.URL.Path += "/"
+				}
+				queue = append(queue, e.URL)
+				continue
+			}
+
+			// Hand back URLs in the scheme the user gave us
+			fileURL := *e.URL
+			fileURL.Scheme = u.Scheme
+			fileURL.User = u.User
+			files = append(files, remoteFile{
+				URL:     fileURL.String(),
+				RelPath: rootName + strings.TrimPrefix(entryPath, rootPath),
+				Size:    e.Size,
+			})
+		}
+	}
+	return files, nil
+}
+
+// supportsWebDAV reports whether the server advertises a DAV class.
+func supportsWebDAV(u *url.URL) bool {
+	req, err := http.NewRequest("OPTIONS", u.String(), nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.Header.Get("DAV") != ""
+}
+
+func propfind(u *url.URL, depth string) ([]davEntry, error) {
+	req, err := http.NewRequest("PROPFIND", u.String(), strings.NewReader(davPropfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND returned %s", resp.Status)
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("invalid PROPFIND response: %v", err)
+	}
+
+	var entries []davEntry
+	for _, r := range ms.Responses {
+		href, err := url.Parse(strings.TrimSpace(r.Href))
+		if err != nil {
+			continue
+		}
+		entry := davEntry{URL: u.ResolveReference(href)}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			entry.IsCollection = ps.Prop.ResourceType.Collection != nil
+			entry.Size = ps.Prop.ContentLength
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// isHTTPFolderURL spots http(s) URLs that may be WebDAV collections.
+func isHTTPFolderURL(urlStr string) bool {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return (scheme == "http" || scheme == "https") && strings.HasSuffix(u.Path, "/")
+}
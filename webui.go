@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+//go:embed web
+var webAssets embed.FS
+
+// webSettings configures the browser interface. Unlike the control server
+// it listens on every interface, so it always needs a password.
+type webSettings struct {
+	Enabled  bool
+	Port     int
+	Password string
+}
+
+const (
+	webSessionCookie = "dm_session"
+	webSessionTTL    = 7 * 24 * time.Hour
+)
+
+// webSessions maps session tokens to their expiry.
+var webSessions = struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+}{tokens: map[string]time.Time{}}
+
+// Wrong passwords an address may try before it is locked out for
+// webLockout, counted until a lockout's worth of quiet has passed.
+const (
+	webMaxFailures = 5
+	webLockout     = 15 * time.Minute
+)
+
+// webFailures counts recent wrong passwords per client address.
+var webFailures = struct {
+	mu   sync.Mutex
+	byIP map[string]*loginFailures
+}{byIP: map[string]*loginFailures{}}
+
+type loginFailures struct {
+	count int
+	last  time.Time
+}
+
+// loginLockout reports how long ip must wait before trying again.
+func loginLockout(ip string) time.Duration {
+	webFailures.mu.Lock()
+	defer webFailures.mu.Unlock()
+	f := webFailures.byIP[ip]
+	if f == nil || f.count < webMaxFailures {
+		return 0
+	}
+	return max(time.Until(f.last.Add(webLockout)), 0)
+}
+
+// recordLogin counts a failed attempt from ip or forgets its failures
+// after a good one.
+func recordLogin(ip string, ok bool) {
+	webFailures.mu.Lock()
+	defer webFailures.mu.Unlock()
+	if ok {
+		delete(webFailures.byIP, ip)
+		return
+	}
+
+	now := time.Now()
+	for addr, f := range webFailures.byIP {
+		if now.Sub(f.last) > webLockout {
+			delete(webFailures.byIP, addr)
+		}
+	}
+	f := webFailures.byIP[ip]
+	if f == nil {
+		f = &loginFailures{}
+		webFailures.byIP[ip] = f
+	}
+	f.count++
+	f.last = now
+}
+
+// startWebUI (re)starts the web interface to match the web settings.
+func (d *Downloader) startWebUI() {
+	d.mu.Lock()
+	old := d.webServer
+	d.webServer = nil
+	d.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	cfg := d.config().Web
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.Password == "" {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("Web interface not started: set a password first"), d.window)
+		})
+		return
+	}
+
+	static, _ := fs.Sub(webAssets, "web")
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(static))
+	mux.HandleFunc("POST /login", d.webLogin)
+	mux.HandleFunc("POST /logout", d.webLogout)
+	d.registerREST(mux, d.webAuth)
+
+	srv := &http.Server{
+		Addr:              net.JoinHostPort("", strconv.Itoa(cfg.Port)),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("Web interface not started: %v", err), d.window)
+		})
+		return
+	}
+	d.mu.Lock()
+	d.webServer = srv
+	d.mu.Unlock()
+	go srv.Serve(ln)
+}
+
+func (d *Downloader) webLogin(w http.ResponseWriter, r *http.Request) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if wait := loginLockout(ip); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		restError(w, http.StatusTooManyRequests, "too many wrong passwords, try again later")
+		return
+	}
+
+	password := r.FormValue("password")
+	if subtle.ConstantTimeCompare([]byte(password), []byte(d.config().Web.Password)) != 1 {
+		recordLogin(ip, false)
+		// Slow down guessing
+		time.Sleep(time.Second)
+		restError(w, http.StatusUnauthorized, "wrong password")
+		return
+	}
+	recordLogin(ip, true)
+
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+
+	webSessions.mu.Lock()
+	now := time.Now()
+	for t, expiry := range webSessions.tokens {
+		if now.After(expiry) {
+			delete(webSessions.tokens, t)
+		}
+	}
+	webSessions.tokens[token] = now.Add(webSessionTTL)
+	webSessions.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     webSessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(webSessionTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *Downloader) webLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(webSessionCookie); err == nil {
+		webSessions.mu.Lock()
+		delete(webSessions.tokens, c.Value)
+		webSessions.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: webSessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webAuth lets requests with a live session through. Changes must also
+// carry a header that cross-site forms cannot set.
+func (d *Downloader) webAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(webSessionCookie)
+		if err != nil {
+			restError(w, http.StatusUnauthorized, "login required")
+			return
+		}
+		webSessions.mu.Lock()
+		expiry, ok := webSessions.tokens[c.Value]
+		webSessions.mu.Unlock()
+		if !ok || time.Now().After(expiry) {
+			restError(w, http.StatusUnauthorized, "login required")
+			return
+		}
+		if r.Method != http.MethodGet && r.Header.Get("X-Requested-With") == "" {
+			restError(w, http.StatusForbidden, "missing X-Requested-With header")
+			return
+		}
+		next(w, r)
+	}
+}